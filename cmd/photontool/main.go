@@ -1,54 +1,121 @@
 package main
 
 import (
-	_ "fmt"
+	"encoding/json"
+	"fmt"
 	"image"
 	"image/draw"
 	"image/png"
+	"io"
 	"log"
 	"os"
+	"strings"
+	"text/tabwriter"
 
 	"github.com/Andoryuuta/photon"
+	"github.com/Andoryuuta/photon/profiles"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
 var (
 	extractPreview   = kingpin.Flag("extract-preview", "Extract the preview files").Default("false").Bool()
-	debugPrint       = kingpin.Flag("debugprint", "Print debug information about the file").Default("false").Bool()
+	debugPrint       = kingpin.Flag("debugprint", "Print debug information about the file (same as --inspect=table)").Default("false").Bool()
+	inspect          = kingpin.Flag("inspect", "Print every section and field of the input file, as a table or json").Enum("table", "json")
+	salvage          = kingpin.Flag("salvage", "Recover what can be read from a truncated or corrupted file").Default("false").Bool()
+	validate         = kingpin.Flag("validate", "Check the file for problems the printer firmware may not handle").Default("false").Bool()
 	replacePreview   = kingpin.Flag("replace-preview", "Replace the preview image with the given .png").HintOptions("custom_preview.png").ExistingFile()
 	replaceThumbnail = kingpin.Flag("replace-thumbnail", "Replace the thumbnail image with the given .png").HintOptions("custom_preview.png").ExistingFile()
 	extractDir       = kingpin.Flag("extractdir", "Extraction directory.").Default("./").String()
-	inputFile        = kingpin.Arg("input", "Input .photon/.cbddlp file").Required().ExistingFile()
-	outputFile       = kingpin.Arg("output", "Output .photon/.cbddlp file").String()
+	machineName      = kingpin.Flag("machine-name", "Set the machine name stored in the file (version 2 only).").String()
+	layoutFrom       = kingpin.Flag("layout-from", "Write the output with the same section order and padding as the given file.").ExistingFile()
+	outputVersion    = kingpin.Flag("output-version", "File format version to write (1 or 2). Defaults to the input file's version.").Uint32()
+
+	editCmd    = kingpin.Command("edit", "Inspect, modify or convert a file. This is the default command.").Default()
+	inputFile  = editCmd.Arg("input", "Input .photon/.cbddlp file").Required().ExistingFile()
+	outputFile = editCmd.Arg("output", "Output .photon/.cbddlp file").String()
+
+	applyResinCmd = kingpin.Command("apply-resin", "Apply a resin profile's exposure, off time and lift settings to every layer of a file.")
+	resinProfiles = applyResinCmd.Flag("profiles", "JSON file of resin profiles.").Required().ExistingFile()
+	resinName     = applyResinCmd.Flag("resin", "Name of the resin profile to apply, not needed if the profiles file only has one.").String()
+	resinPrinter  = applyResinCmd.Flag("printer", "Printer the resin profile was tuned for. Defaults to the file's machine name.").String()
+	resinInput    = applyResinCmd.Arg("input", "Input .photon/.cbddlp file").Required().ExistingFile()
+	resinOutput   = applyResinCmd.Arg("output", "Output .photon/.cbddlp file").Required().String()
 )
 
 func main() {
 	// Parse command line
 	kingpin.UsageTemplate(kingpin.CompactUsageTemplate).Version("0.0.1").Author("Andrew Gutekanst")
 	kingpin.CommandLine.Help = "photontool is a tool for working with .photon/.cbddlp or any other file that matches the Chitu D series DLP file format.\n\nSee http://github.com/Andoryuuta/photon for more information."
-	kingpin.Parse()
+	if kingpin.Parse() == applyResinCmd.FullCommand() {
+		applyResin()
+		return
+	}
+
+	if *machineName != "" && *outputVersion != 0 && *outputVersion < photon.Version2 {
+		log.Panicf("--machine-name is only stored in version 2 files, but --output-version is %d\n", *outputVersion)
+	}
 
 	input, err := os.Open(*inputFile)
 	if err != nil {
 		log.Panicf("Failed to open file '%s': %v\n", *inputFile, err)
 	}
 
-	pfi, err := photon.Decode(input)
-	if err != nil {
-		log.Panicf("Failed to decode input file: %v\n", err)
+	var pfi *photon.PhotonFile
+	if *salvage {
+		var report *photon.SalvageReport
+		pfi, report, err = photon.DecodeSalvage(input)
+		if err != nil {
+			log.Panicf("Failed to salvage input file: %v\n", err)
+		}
+
+		for _, problem := range report.Problems {
+			log.Println(problem)
+		}
+		log.Printf("Salvaged %d of %d layers, dropped layers: %v\n", len(pfi.Layers), report.TotalLayers, report.BrokenLayers)
+	} else {
+		var format string
+		pfi, format, err = photon.DecodeAny(input)
+		if err != nil {
+			log.Panicf("Failed to decode input file: %v\n", err)
+		}
+		log.Printf("Decoded %s file.\n", format)
+	}
+
+	if *debugPrint && *inspect == "" {
+		*inspect = "table"
 	}
 
-	if *debugPrint {
+	if *inspect != "" {
 		dif, err := os.Open(*inputFile)
 		if err != nil {
-			log.Panicf("Failed to open file '%s' for debug printing: %v\n", *inputFile, err)
+			log.Panicf("Failed to open file '%s' for inspection: %v\n", *inputFile, err)
 		}
-		err = photon.DebugPrint(dif)
+		defer dif.Close()
+		ins, err := photon.Inspect(dif)
 		if err != nil {
-			log.Panicf("Failed to debug print!: %v\n", err)
+			log.Panicf("Failed to inspect file: %v\n", err)
+		}
+
+		if *inspect == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(ins)
+		} else {
+			err = printInspection(os.Stdout, ins)
+		}
+		if err != nil {
+			log.Panicf("Failed to print inspection: %v\n", err)
 		}
 	}
 
+	if *validate {
+		problems := pfi.Validate()
+		for _, p := range problems {
+			log.Println(p)
+		}
+		log.Printf("Found %d problem(s).\n", len(problems))
+	}
+
 	if *extractPreview {
 		log.Println("Extracting preview images...")
 		err := extractPreviewImages(pfi)
@@ -87,13 +154,48 @@ func main() {
 		log.Println("Replaced thumbnail image.")
 	}
 
+	if *outputVersion != 0 {
+		pfi.Version = *outputVersion
+	}
+
+	if *machineName != "" {
+		if pfi.Version < photon.Version2 {
+			log.Println("Machine name is only stored in version 2 files, writing a version 2 file.")
+			pfi.Version = photon.Version2
+		}
+		pfi.MachineName = *machineName
+
+		log.Println("Set machine name.")
+	}
+
+	if *layoutFrom != "" {
+		f, err := os.Open(*layoutFrom)
+		if err != nil {
+			log.Panicf("Failed to open file '%s': %v\n", *layoutFrom, err)
+		}
+		defer f.Close()
+		ref, err := photon.Decode(f)
+		if err != nil {
+			log.Panicf("Failed to decode layout file: %v\n", err)
+		}
+		pfi.Layout = ref.Layout
+
+		log.Println("Copied file layout.")
+	}
+
 	if *outputFile != "" {
 		of, err := os.Create(*outputFile)
 		if err != nil {
 			log.Panicf("Error creating output file '%v': %v\n", *outputFile, err)
 		}
 
-		err = pfi.EncodeTo(of)
+		// Write the format matching the output file's extension, or the Chitu format for unknown ones.
+		format, ok := photon.FormatForFile(*outputFile)
+		if !ok {
+			format = "photon"
+		}
+
+		err = pfi.EncodeAs(of, format)
 		if err != nil {
 			log.Panicf("Failed to encode output file: %v\n", err)
 		}
@@ -102,6 +204,108 @@ func main() {
 	log.Println("Completed!")
 }
 
+// applyResin runs the apply-resin command.
+func applyResin() {
+	f, err := os.Open(*resinProfiles)
+	if err != nil {
+		log.Panicf("Failed to open file '%s': %v\n", *resinProfiles, err)
+	}
+	defer f.Close()
+	resins, err := profiles.LoadResins(f)
+	if err != nil {
+		log.Panicf("Failed to load resin profiles: %v\n", err)
+	}
+
+	input, err := os.Open(*resinInput)
+	if err != nil {
+		log.Panicf("Failed to open file '%s': %v\n", *resinInput, err)
+	}
+	defer input.Close()
+	pfi, _, err := photon.DecodeAny(input)
+	if err != nil {
+		log.Panicf("Failed to decode input file: %v\n", err)
+	}
+
+	printer := *resinPrinter
+	if printer == "" {
+		printer = pfi.MachineName
+	}
+
+	var resin photon.ResinProfile
+	switch {
+	case *resinName != "":
+		var ok bool
+		resin, ok = profiles.LookupResin(*resinName, printer)
+		if !ok {
+			if printers := profiles.ResinPrinters(*resinName); len(printers) > 0 {
+				log.Panicf("No resin profile named '%s' for printer '%s', pick one of %q with --printer\n", *resinName, printer, printers)
+			}
+			log.Panicf("No resin profile named '%s' in '%s'\n", *resinName, *resinProfiles)
+		}
+	case len(resins) == 1:
+		resin = resins[0]
+	default:
+		log.Panicf("'%s' has %d resin profiles, pick one with --resin\n", *resinProfiles, len(resins))
+	}
+
+	err = pfi.ApplyResinProfile(resin)
+	if err != nil {
+		log.Panicf("Failed to apply resin profile: %v\n", err)
+	}
+	log.Printf("Applied resin profile '%s' to %d layers.\n", resin.Name, len(pfi.Layers))
+
+	format, ok := photon.FormatForFile(*resinOutput)
+	if !ok {
+		format = "photon"
+	}
+
+	of, err := os.Create(*resinOutput)
+	if err != nil {
+		log.Panicf("Error creating output file '%v': %v\n", *resinOutput, err)
+	}
+	defer of.Close()
+	err = pfi.EncodeAs(of, format)
+	if err != nil {
+		log.Panicf("Failed to encode output file: %v\n", err)
+	}
+
+	log.Println("Completed!")
+}
+
+// printInspection writes the inspected sections and fields out as a table.
+func printInspection(w io.Writer, ins *photon.Inspection) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 1, ' ', 0)
+	fmt.Fprintln(tw, "OFFSET\tSIZE\tNAME\tRAW\tVALUE")
+
+	var printSections func(sections []photon.InspectSection, indent string)
+	printSections = func(sections []photon.InspectSection, indent string) {
+		for _, s := range sections {
+			fmt.Fprintf(tw, "0x%X\t%d\t%s%s\t\t%s\n", s.Offset, s.Size, indent, s.Name, s.Value)
+			for _, f := range s.Fields {
+				unknown := ""
+				if f.Unknown {
+					unknown = " (unknown)"
+				}
+				fmt.Fprintf(tw, "0x%X\t%d\t%s  %s\t0x%X\t%s%s\n", f.Offset, f.Size, indent, f.Name, f.Raw, f.Value, unknown)
+			}
+			printSections(s.Sections, indent+"  ")
+		}
+	}
+	printSections(ins.Sections, "")
+
+	for _, g := range ins.Gaps {
+		fmt.Fprintf(tw, "0x%X\t%d\tgap after %s\t\t\n", g.Offset, g.Size, g.Sections[0])
+	}
+	for _, o := range ins.Overlaps {
+		fmt.Fprintf(tw, "0x%X\t%d\toverlap of %s\t\t\n", o.Offset, o.Size, strings.Join(o.Sections, " and "))
+	}
+	for _, p := range ins.Problems {
+		fmt.Fprintf(tw, "\t\tproblem\t\t%s\n", p)
+	}
+
+	return tw.Flush()
+}
+
 func extractPreviewImages(pf *photon.PhotonFile) error {
 	// Write preview
 	f, err := os.Create(*extractDir + "preview.png")
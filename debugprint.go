@@ -8,6 +8,8 @@ import (
 
 // Prototyping/ debug function.
 // Dont even try to use.
+//
+// Deprecated: Use Inspect, which maps out every section and field of the file.
 func DebugPrint(rdr io.ReadSeeker) error {
 	// Read main file header
 	var header binCompatFileHeader
@@ -0,0 +1,168 @@
+package photon
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+/*
+Layout written by the Encoder, the layer header tables go last since we don't
+know how many layers there are until Close:
+
+header
+previewHeader ... machineName (in the order given by pf.Layout, as with EncodeTo)
+
+layer0Data
+layer1Data
+...
+
+layer0Header
+layer1Header
+...
+(repeated for each anti-aliasing level)
+
+Unlike EncodeTo, which writes each anti-aliasing level's data in turn, the
+Encoder writes all the levels of one layer before moving on to the next. Decode
+can't reproduce that order, so files from an anti-aliased Encoder decode with a
+nil Layout.
+*/
+
+// Encoder writes a file one layer at a time, so that the layer data never
+// has to be held in memory all at once.
+type Encoder struct {
+	w      io.WriteSeeker
+	header binCompatFileHeader
+	levels int
+	pos    int64
+
+	// One table of layer headers per anti-aliasing level.
+	layerHeaders [][]binCompatLayerHeader
+	closed       bool
+
+	// Set once a write fails, since we don't know how much of it made it into the file.
+	err error
+}
+
+// Creates an Encoder and writes out everything up to the layer data.
+// The settings and previews are taken from pf, its Layers are ignored;
+// use WriteLayer to add them. RelativeLayerOffsets isn't supported.
+// pf.Layout is followed for everything but the layer sections and the trailer.
+func NewEncoder(w io.WriteSeeker, pf *PhotonFile) (*Encoder, error) {
+	version, err := pf.encodeVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	if pf.RelativeLayerOffsets {
+		return nil, errors.New("photon: the streaming encoder can't write relative layer offsets")
+	}
+
+	layout, err := pf.layout()
+	if err != nil {
+		return nil, err
+	}
+
+	// The layer table offset and count get patched in by Close.
+	fs := pf.buildSections(version, layout, -1, -1)
+	err = fs.writeTo(w, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Encoder{
+		w:      w,
+		header: fs.header,
+		levels: pf.antiAliasLevels(version),
+		pos:    fs.size,
+	}
+	e.layerHeaders = make([][]binCompatLayerHeader, e.levels)
+
+	return e, nil
+}
+
+// Writes the image data of the next layer. When the file has more than one
+// anti-aliasing level, l.AntiAliasRawData must hold the remaining levels.
+// Once a write fails the Encoder can't be used any more, WriteLayer and Close
+// return the same error.
+func (e *Encoder) WriteLayer(l Layer) error {
+	if e.err != nil {
+		return e.err
+	}
+	if e.closed {
+		return errors.New("photon: WriteLayer called on a closed Encoder")
+	}
+
+	if len(l.AntiAliasRawData) != e.levels-1 {
+		return fmt.Errorf("photon: layer %d has %d anti-aliasing levels, expected %d", len(e.layerHeaders[0]), len(l.AntiAliasRawData)+1, e.levels)
+	}
+
+	// Work out the headers before writing anything, so a layer is either written or not.
+	levelData := append([][]byte{l.RawData}, l.AntiAliasRawData...)
+	headers := make([]binCompatLayerHeader, e.levels)
+	pos := e.pos
+	for level, data := range levelData {
+		if pos > layerOffsetMask {
+			return fmt.Errorf("photon: layer %d data offset 0x%X doesn't fit in a layer header", len(e.layerHeaders[0]), pos)
+		}
+		headers[level] = l.header(uint32(pos), uint32(len(data)))
+		pos += int64(len(data))
+	}
+
+	for _, data := range levelData {
+		_, err := e.w.Write(data)
+		if err != nil {
+			e.err = err
+			return err
+		}
+	}
+
+	for level, h := range headers {
+		e.layerHeaders[level] = append(e.layerHeaders[level], h)
+	}
+	e.pos = pos
+
+	return nil
+}
+
+// Writes the layer header tables and patches the file header to point at them.
+// It does not close the underlying writer.
+func (e *Encoder) Close() error {
+	if e.err != nil {
+		return e.err
+	}
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+
+	e.err = e.writeLayerHeaders()
+	return e.err
+}
+
+// writeLayerHeaders writes the layer header tables, and points the file header at them.
+func (e *Encoder) writeLayerHeaders() error {
+	e.header.LayerHeadersOffset = uint32(e.pos)
+	e.header.TotalLayers = uint32(len(e.layerHeaders[0]))
+
+	for _, table := range e.layerHeaders {
+		err := binary.Write(e.w, binary.LittleEndian, table)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := e.w.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	err = binary.Write(e.w, binary.LittleEndian, e.header)
+	if err != nil {
+		return err
+	}
+
+	_, err = e.w.Seek(0, io.SeekEnd)
+	return err
+}
@@ -0,0 +1,125 @@
+package photon
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestEncoder(t *testing.T) {
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pf := tc.pf(t)
+
+			f, err := ioutil.TempFile("", "photon")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(f.Name())
+			defer f.Close()
+
+			e, err := NewEncoder(f, pf)
+			if pf.RelativeLayerOffsets {
+				if err == nil {
+					t.Error("streamed relative layer offsets")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, l := range pf.Layers {
+				err = e.WriteLayer(l)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err = e.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.WriteLayer(pf.Layers[0]) == nil {
+				t.Error("wrote a layer after Close")
+			}
+
+			_, err = f.Seek(0, io.SeekStart)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := Decode(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded.MachineName != pf.MachineName || len(decoded.Layers) != len(pf.Layers) {
+				t.Fatalf("decoded %q with %d layers", decoded.MachineName, len(decoded.Layers))
+			}
+			for idx := range pf.Layers {
+				if !reflect.DeepEqual(decoded.Layers[idx].RawData, pf.Layers[idx].RawData) || !reflect.DeepEqual(decoded.Layers[idx].AntiAliasRawData, pf.Layers[idx].AntiAliasRawData) {
+					t.Errorf("layer %d differs", idx)
+				}
+			}
+		})
+	}
+}
+
+// failingWriter is an in memory io.WriteSeeker whose writes fail once it holds limit bytes.
+type failingWriter struct {
+	data  []byte
+	pos   int64
+	limit int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(w.data)+len(p) > w.limit {
+		return 0, errDiskGone
+	}
+	w.data = append(w.data[:w.pos], p...)
+	w.pos += int64(len(p))
+	return len(p), nil
+}
+
+func (w *failingWriter) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+		w.pos = offset
+	case io.SeekEnd:
+		w.pos = int64(len(w.data)) + offset
+	}
+	return w.pos, nil
+}
+
+func TestEncoderWriteFailure(t *testing.T) {
+	pf := testFile(t, Version2, 2)
+	w := &failingWriter{limit: 1 << 20}
+	e, err := NewEncoder(w, pf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = e.WriteLayer(Layer{RawData: pf.Layers[0].RawData})
+	if err == nil {
+		t.Error("wrote a layer with missing anti-aliasing levels")
+	}
+
+	// The second level fails to write.
+	w.limit = len(w.data) + len(pf.Layers[0].RawData) + 1
+	err = e.WriteLayer(pf.Layers[0])
+	if err != errDiskGone {
+		t.Fatalf("got %v, expected the writer's error", err)
+	}
+	if len(e.layerHeaders[0]) != 0 || len(e.layerHeaders[1]) != 0 {
+		t.Errorf("half written layer has %d and %d headers", len(e.layerHeaders[0]), len(e.layerHeaders[1]))
+	}
+
+	// Once a write has failed the Encoder stays failed.
+	w.limit = 1 << 20
+	if err := e.WriteLayer(pf.Layers[0]); !errors.Is(err, errDiskGone) {
+		t.Errorf("WriteLayer after a failure gave %v", err)
+	}
+	if err := e.Close(); !errors.Is(err, errDiskGone) {
+		t.Errorf("Close after a failure gave %v", err)
+	}
+}
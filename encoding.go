@@ -0,0 +1,94 @@
+package photon
+
+import (
+	"bytes"
+	"encoding"
+	"io"
+	"io/ioutil"
+)
+
+var (
+	_ io.WriterTo                = (*PhotonFile)(nil)
+	_ io.ReaderFrom              = (*PhotonFile)(nil)
+	_ encoding.BinaryMarshaler   = (*PhotonFile)(nil)
+	_ encoding.BinaryUnmarshaler = (*PhotonFile)(nil)
+)
+
+// readSeeker returns rdr as an io.ReadSeeker, reading it all into memory
+// if it can't seek (e.g. a pipe or a network connection).
+func readSeeker(rdr io.Reader) (io.ReadSeeker, error) {
+	if rs, ok := rdr.(io.ReadSeeker); ok {
+		// Pipes are *os.Files too, but fail to seek.
+		_, err := rs.Seek(0, io.SeekCurrent)
+		if err == nil {
+			return rs, nil
+		}
+	}
+
+	data, err := ioutil.ReadAll(rdr)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// Decodes a file held in memory.
+func DecodeBytes(data []byte) (*PhotonFile, error) {
+	return Decode(bytes.NewReader(data))
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// Encodes the file to w, implementing io.WriterTo.
+func (pf *PhotonFile) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	err := pf.EncodeTo(cw)
+	return cw.n, err
+}
+
+// Decodes a file from r into pf, replacing all of its contents. It implements io.ReaderFrom,
+// reading r to EOF and returning the number of bytes read.
+func (pf *PhotonFile) ReadFrom(r io.Reader) (int64, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return int64(len(data)), err
+	}
+
+	decoded, err := DecodeBytes(data)
+	if err != nil {
+		return int64(len(data)), err
+	}
+	*pf = *decoded
+	return int64(len(data)), nil
+}
+
+// Encodes the file, implementing encoding.BinaryMarshaler.
+func (pf *PhotonFile) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	err := pf.EncodeTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decodes data into pf, replacing all of its contents. It implements encoding.BinaryUnmarshaler.
+// The decoded layers and previews don't refer to data, so it may be reused afterwards.
+func (pf *PhotonFile) UnmarshalBinary(data []byte) error {
+	decoded, err := DecodeBytes(data)
+	if err != nil {
+		return err
+	}
+	*pf = *decoded
+	return nil
+}
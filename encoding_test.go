@@ -0,0 +1,95 @@
+package photon
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// onlyReader hides every method of the reader but Read, like a pipe.
+type onlyReader struct {
+	io.Reader
+}
+
+func TestWriteTo(t *testing.T) {
+	pf := testFile(t, Version2, 0)
+	data := encodeTest(t, pf)
+
+	var buf bytes.Buffer
+	n, err := pf.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) || !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("wrote %d bytes, expected the %d EncodeTo writes", n, len(data))
+	}
+
+	marshaled, err := pf.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(marshaled, data) {
+		t.Error("MarshalBinary differs from EncodeTo")
+	}
+}
+
+func TestReadFrom(t *testing.T) {
+	data := encodeTest(t, testFile(t, Version2, 0))
+
+	var pf PhotonFile
+	n, err := pf.ReadFrom(onlyReader{bytes.NewReader(data)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) {
+		t.Errorf("read %d bytes, expected %d", n, len(data))
+	}
+	if !bytes.Equal(encodeTest(t, &pf), data) {
+		t.Error("re-encoded file differs")
+	}
+
+	// A failed read leaves the file as it was.
+	_, err = pf.ReadFrom(bytes.NewReader(data[:0x40]))
+	if !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("reading a truncated file gave %v, expected ErrOutOfRange", err)
+	}
+	if len(pf.Layers) != 6 {
+		t.Errorf("failed read left %d layers", len(pf.Layers))
+	}
+
+	decoded, err := Decode(onlyReader{bytes.NewReader(data)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encodeTest(t, decoded), data) {
+		t.Error("file decoded from a reader that can't seek differs")
+	}
+}
+
+func TestUnmarshalBinary(t *testing.T) {
+	data := encodeTest(t, testFile(t, Version2, 0))
+	scratch := append([]byte(nil), data...)
+
+	var pf PhotonFile
+	err := pf.UnmarshalBinary(scratch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The caller may reuse the data afterwards.
+	for idx := range scratch {
+		scratch[idx] = 0xFF
+	}
+	if !bytes.Equal(encodeTest(t, &pf), data) {
+		t.Error("re-encoded file differs after the data was overwritten")
+	}
+
+	decoded, err := DecodeBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Layers) != len(pf.Layers) {
+		t.Errorf("DecodeBytes decoded %d layers, expected %d", len(decoded.Layers), len(pf.Layers))
+	}
+}
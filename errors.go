@@ -0,0 +1,38 @@
+package photon
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrBadMagic is returned when the file does not start with the Chitu D series magic number.
+	ErrBadMagic = errors.New("photon: bad magic number")
+
+	// ErrUnsupportedVersion is returned when the file header has a version we can't decode.
+	ErrUnsupportedVersion = errors.New("photon: unsupported file version")
+
+	// ErrOutOfRange is returned when an offset or size points outside of the file.
+	ErrOutOfRange = errors.New("photon: offset or size out of range")
+
+	// ErrTooLarge is returned when a count or dimension exceeds the decoder's sanity limits.
+	ErrTooLarge = errors.New("photon: size exceeds decoder limits")
+
+	// ErrBadImageData is reported by DecodeSalvage for layer image data that doesn't cover the screen exactly.
+	ErrBadImageData = errors.New("photon: layer image data doesn't match the screen size")
+)
+
+// FormatError describes a problem with a specific section of the file.
+type FormatError struct {
+	Section string // Name of the section being read, e.g. "header" or "layer 12".
+	Offset  int64  // Byte offset of the section within the file.
+	Err     error  // Underlying error.
+}
+
+func (e *FormatError) Error() string {
+	return fmt.Sprintf("photon: invalid %s at offset 0x%X: %v", e.Section, e.Offset, e.Err)
+}
+
+func (e *FormatError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,78 @@
+package photon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestDecodeErrors(t *testing.T) {
+	valid := encodeTest(t, testFile(t, Version1, 0))
+
+	tests := []struct {
+		name   string
+		offset int
+		value  uint32
+		err    error
+	}{
+		{"bad magic", 0x00, 0x12345678, ErrBadMagic},
+		{"unsupported version", 0x04, 3, ErrUnsupportedVersion},
+		{"screen too tall", 0x34, 1 << 20, ErrTooLarge},
+		{"screen too wide", 0x38, 1 << 20, ErrTooLarge},
+		{"too many layers", 0x44, 1 << 30, ErrTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := append([]byte(nil), valid...)
+			binary.LittleEndian.PutUint32(data[tt.offset:], tt.value)
+
+			_, err := Decode(bytes.NewReader(data))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, expected %v", err, tt.err)
+			}
+			var formatErr *FormatError
+			if !errors.As(err, &formatErr) || formatErr.Offset != int64(tt.offset) {
+				t.Errorf("got %#v, expected a *FormatError at offset 0x%X", err, tt.offset)
+			}
+		})
+	}
+
+	_, err := Decode(bytes.NewReader(valid[:0x40]))
+	if !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("decoding a truncated header gave %v, expected ErrOutOfRange", err)
+	}
+}
+
+var errDiskGone = errors.New("disk gone")
+
+// failingReader fails every seek after the first few.
+type failingReader struct {
+	*bytes.Reader
+	seeks int
+}
+
+func (r *failingReader) Seek(offset int64, whence int) (int64, error) {
+	r.seeks--
+	if r.seeks < 0 {
+		return 0, errDiskGone
+	}
+	return r.Reader.Seek(offset, whence)
+}
+
+func TestDecodeIOError(t *testing.T) {
+	data := encodeTest(t, testFile(t, Version1, 0))
+
+	// Decode reads readers that can't seek at all into memory, so let the first seek through.
+	for seeks := 1; seeks < 10; seeks++ {
+		_, err := Decode(&failingReader{bytes.NewReader(data), seeks})
+		if err != errDiskGone {
+			t.Errorf("failing after %d seeks gave %v, expected the reader's error", seeks, err)
+		}
+
+		_, _, err = DecodeSalvage(&failingReader{bytes.NewReader(data), seeks})
+		if err != errDiskGone {
+			t.Errorf("salvaging after %d seeks gave %v, expected the reader's error", seeks, err)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package photon
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrFormat is returned by DecodeAny and friends when no registered format matches the file.
+var ErrFormat = errors.New("photon: unknown format")
+
+// A registered file format.
+type format struct {
+	name         string
+	magic        string
+	extensions   []string
+	decode       func(io.ReadSeeker) (*PhotonFile, error)
+	decodeConfig func(io.ReadSeeker, bool) (*PhotonFile, error)
+	encode       func(io.Writer, *PhotonFile) error
+}
+
+var (
+	formatsMu sync.Mutex
+	formats   []format
+)
+
+// Registers a file format for use by DecodeAny, DecodeConfigAny and EncodeAs, in the style of
+// image.RegisterFormat. Name is the name of the format, like "photon". Magic is the magic prefix
+// that identifies the format's encoding, a "?" matches any one byte. Extensions (e.g. ".photon")
+// are used to pick the format of files with no recognisable magic.
+//
+// Formats are tried in the order they were registered. The Chitu D series format is
+// registered as "photon". Decoders are handed the reader positioned at offset 0, where
+// the file starts.
+func RegisterFormat(name string, magic string, decode func(io.ReadSeeker) (*PhotonFile, error), decodeConfig func(io.ReadSeeker, bool) (*PhotonFile, error), encode func(io.Writer, *PhotonFile) error, extensions ...string) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+
+	formats = append(formats, format{name, magic, extensions, decode, decodeConfig, encode})
+}
+
+func init() {
+	magic := string([]byte{headerMagic & 0xFF, (headerMagic >> 8) & 0xFF, (headerMagic >> 16) & 0xFF, headerMagic >> 24})
+	decode := func(rdr io.ReadSeeker) (*PhotonFile, error) {
+		return Decode(rdr)
+	}
+	RegisterFormat("photon", magic, decode, DecodeConfig, func(w io.Writer, pf *PhotonFile) error {
+		return pf.EncodeTo(w)
+	}, ".photon", ".cbddlp")
+}
+
+// registeredFormats returns a snapshot of the registered formats.
+func registeredFormats() []format {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+
+	return formats[:len(formats):len(formats)]
+}
+
+// matchMagic reports whether magic matches b, with "?" matching any byte.
+func matchMagic(magic string, b []byte) bool {
+	if magic == "" || len(magic) > len(b) {
+		return false
+	}
+	for i, c := range []byte(magic) {
+		if c != b[i] && c != '?' {
+			return false
+		}
+	}
+	return true
+}
+
+// FormatForFile returns the name of the registered format using the extension of filename.
+func FormatForFile(filename string) (string, bool) {
+	f, ok := formatForExtension(filename)
+	return f.name, ok
+}
+
+func formatForExtension(filename string) (format, bool) {
+	ext := filepath.Ext(filename)
+	for _, f := range registeredFormats() {
+		for _, e := range f.extensions {
+			if strings.EqualFold(e, ext) {
+				return f, true
+			}
+		}
+	}
+	return format{}, false
+}
+
+// sniff works out the format of rdr from its magic, falling back on the file name's extension
+// if rdr has one (like an *os.File). Files start at offset 0, whatever the position of rdr,
+// as they do for Decode; rdr is left at offset 0 for the format's decoder.
+func sniff(rdr io.ReadSeeker) (format, error) {
+	_, err := rdr.Seek(0, io.SeekStart)
+	if err != nil {
+		return format{}, err
+	}
+
+	formats := registeredFormats()
+	maxMagic := 0
+	for _, f := range formats {
+		if len(f.magic) > maxMagic {
+			maxMagic = len(f.magic)
+		}
+	}
+
+	var buf bytes.Buffer
+	_, err = io.CopyN(&buf, rdr, int64(maxMagic))
+	if err != nil && err != io.EOF {
+		return format{}, err
+	}
+	_, err = rdr.Seek(0, io.SeekStart)
+	if err != nil {
+		return format{}, err
+	}
+
+	for _, f := range formats {
+		if matchMagic(f.magic, buf.Bytes()) {
+			return f, nil
+		}
+	}
+
+	if named, ok := rdr.(interface{ Name() string }); ok {
+		if f, ok := formatForExtension(named.Name()); ok {
+			return f, nil
+		}
+	}
+
+	return format{}, ErrFormat
+}
+
+// Decodes a file in any registered format, returning the name of the format along with it.
+// The file is read from offset 0 of rdr, wherever rdr is positioned.
+func DecodeAny(rdr io.ReadSeeker) (*PhotonFile, string, error) {
+	f, err := sniff(rdr)
+	if err != nil {
+		return nil, "", err
+	}
+
+	pf, err := f.decode(rdr)
+	return pf, f.name, err
+}
+
+// Decodes the headers of a file in any registered format, see DecodeConfig.
+func DecodeConfigAny(rdr io.ReadSeeker, withPreviews bool) (*PhotonFile, string, error) {
+	f, err := sniff(rdr)
+	if err != nil {
+		return nil, "", err
+	}
+
+	pf, err := f.decodeConfig(rdr, withPreviews)
+	return pf, f.name, err
+}
+
+// Encodes the file in the named registered format.
+func (pf *PhotonFile) EncodeAs(writer io.Writer, formatName string) error {
+	for _, f := range registeredFormats() {
+		if f.name == formatName {
+			return f.encode(writer, pf)
+		}
+	}
+	return ErrFormat
+}
@@ -0,0 +1,77 @@
+package photon
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestDecodeAny(t *testing.T) {
+	data := encodeTest(t, testFile(t, Version2, 0))
+
+	// Wherever the reader is, the file starts at offset 0.
+	rdr := bytes.NewReader(data)
+	rdr.Seek(10, io.SeekStart)
+	pf, name, err := DecodeAny(rdr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "photon" || len(pf.Layers) != 6 {
+		t.Errorf("decoded a %q file with %d layers", name, len(pf.Layers))
+	}
+
+	pf, name, err = DecodeConfigAny(bytes.NewReader(data), false)
+	if err != nil || name != "photon" || pf.PreviewImage != nil {
+		t.Errorf("DecodeConfigAny gave %q, %v", name, err)
+	}
+
+	_, _, err = DecodeAny(bytes.NewReader([]byte("not a photon file at all")))
+	if err != ErrFormat {
+		t.Errorf("decoding garbage gave %v, expected ErrFormat", err)
+	}
+}
+
+func TestRegisterFormat(t *testing.T) {
+	errTest := errors.New("test format")
+	RegisterFormat("test", "TE?T", func(rdr io.ReadSeeker) (*PhotonFile, error) {
+		magic := make([]byte, 4)
+		_, err := io.ReadFull(rdr, magic)
+		if err != nil || string(magic) != "TEXT" {
+			t.Errorf("test decoder read %q, %v", magic, err)
+		}
+		return &PhotonFile{}, nil
+	}, nil, func(w io.Writer, pf *PhotonFile) error {
+		return errTest
+	}, ".test")
+
+	_, name, err := DecodeAny(bytes.NewReader([]byte("TEXT file")))
+	if err != nil || name != "test" {
+		t.Errorf("decoded a %q file, %v", name, err)
+	}
+
+	if name, ok := FormatForFile("model.TEST"); !ok || name != "test" {
+		t.Errorf("FormatForFile gave %q, %v", name, ok)
+	}
+	if name, ok := FormatForFile("model.cbddlp"); !ok || name != "photon" {
+		t.Errorf("FormatForFile gave %q, %v", name, ok)
+	}
+	if _, ok := FormatForFile("model.stl"); ok {
+		t.Error("found a format for .stl")
+	}
+
+	pf := testFile(t, Version1, 0)
+	if err := pf.EncodeAs(ioutil.Discard, "test"); err != errTest {
+		t.Errorf("EncodeAs used the wrong encoder, got %v", err)
+	}
+	if err := pf.EncodeAs(ioutil.Discard, "no such format"); err != ErrFormat {
+		t.Errorf("EncodeAs an unknown format gave %v", err)
+	}
+
+	var buf bytes.Buffer
+	err = pf.EncodeAs(&buf, "photon")
+	if err != nil || !bytes.Equal(buf.Bytes(), encodeTest(t, pf)) {
+		t.Errorf("EncodeAs photon gave %v", err)
+	}
+}
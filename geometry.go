@@ -0,0 +1,113 @@
+package photon
+
+import (
+	"math"
+	"sort"
+)
+
+// Geometry converts between pixels on the screen, millimetres on the build plate and layers.
+//
+// X and Y follow the images returned by LayerImage: the origin is the top left corner of
+// the plate, X runs along PlateX / ScreenWidth and Y along PlateY / ScreenHeight. Pixels
+// needn't be square, each axis has its own pitch. Pixel coordinates are fractional,
+// pixel (i, j) covers [i, i+1) x [j, j+1) so its centre is at (i+0.5, j+0.5).
+type Geometry struct {
+	PlateX, PlateY float64 // Size of the plate in mm.
+	ScreenWidth    int     // Size of the screen in pixels.
+	ScreenHeight   int
+
+	PitchX, PitchY float64 // Size of a pixel in mm, zero if the screen or plate has no size.
+
+	LayerThickness float64   // In mm.
+	heights        []float64 // AbsoluteHeight of every layer.
+}
+
+// Returns the Geometry of the file as it is now; it doesn't follow later changes to pf.
+func (pf *PhotonFile) Geometry() Geometry {
+	g := Geometry{
+		PlateX:         float64(pf.PlateX),
+		PlateY:         float64(pf.PlateY),
+		ScreenWidth:    int(pf.ScreenWidth),
+		ScreenHeight:   int(pf.ScreenHeight),
+		LayerThickness: float64(pf.LayerThickness),
+	}
+
+	if pf.ScreenWidth != 0 {
+		g.PitchX = g.PlateX / float64(pf.ScreenWidth)
+	}
+	if pf.ScreenHeight != 0 {
+		g.PitchY = g.PlateY / float64(pf.ScreenHeight)
+	}
+
+	for _, l := range pf.Layers {
+		g.heights = append(g.heights, float64(l.AbsoluteHeight))
+	}
+
+	return g
+}
+
+// Returns the centre of the plate in mm.
+func (g Geometry) Centre() (x float64, y float64) {
+	return g.PlateX / 2, g.PlateY / 2
+}
+
+// Returns the centre of the plate in pixels.
+func (g Geometry) CentrePixel() (px float64, py float64) {
+	return float64(g.ScreenWidth) / 2, float64(g.ScreenHeight) / 2
+}
+
+// Converts a position in pixels to mm.
+func (g Geometry) PixelToMM(px float64, py float64) (x float64, y float64) {
+	return px * g.PitchX, py * g.PitchY
+}
+
+// Converts a position in mm to pixels. Both are zero if the pixels have no size.
+func (g Geometry) MMToPixel(x float64, y float64) (px float64, py float64) {
+	if g.PitchX != 0 {
+		px = x / g.PitchX
+	}
+	if g.PitchY != 0 {
+		py = y / g.PitchY
+	}
+	return px, py
+}
+
+// Returns the pixel containing the given position in mm, which may be off the screen.
+func (g Geometry) PixelAt(x float64, y float64) (px int, py int) {
+	fx, fy := g.MMToPixel(x, y)
+	return int(math.Floor(fx)), int(math.Floor(fy))
+}
+
+// Returns the height (in mm) of the given layer. Layers past either end of
+// the file are extrapolated from the nearest one using LayerThickness. Without
+// any layers, layer 0 is at LayerThickness as it is for InsertLayers.
+func (g Geometry) LayerZ(layerIdx int) float64 {
+	if len(g.heights) == 0 {
+		return float64(layerIdx+1) * g.LayerThickness
+	}
+	if layerIdx < 0 {
+		return g.heights[0] + float64(layerIdx)*g.LayerThickness
+	}
+	if last := len(g.heights) - 1; layerIdx > last {
+		return g.heights[last] + float64(layerIdx-last)*g.LayerThickness
+	}
+	return g.heights[layerIdx]
+}
+
+// Returns the index of the layer whose height is closest to z (in mm), or -1 if there are no layers.
+// The layer heights are expected to increase, as Validate checks.
+func (g Geometry) LayerAt(z float64) int {
+	if len(g.heights) == 0 {
+		return -1
+	}
+
+	// First layer at or above z, then whichever neighbour is closer.
+	idx := sort.SearchFloat64s(g.heights, z)
+	if idx == len(g.heights) {
+		return idx - 1
+	}
+	if idx > 0 && z-g.heights[idx-1] <= g.heights[idx]-z {
+		return idx - 1
+	}
+	return idx
+}
@@ -0,0 +1,59 @@
+package photon
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGeometry(t *testing.T) {
+	pf := New(Profile{PlateX: 68.04, PlateY: 120.96, ScreenWidth: 1440, ScreenHeight: 2560, LayerThickness: 0.05})
+	err := pf.InsertLayers(0, make([]Layer, 4)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := pf.Geometry()
+
+	near := func(a float64, b float64) bool {
+		return math.Abs(a-b) < 1e-6
+	}
+
+	if !near(g.PitchX, 0.04725) || !near(g.PitchY, 0.04725) {
+		t.Errorf("pitch is %v x %v", g.PitchX, g.PitchY)
+	}
+	if x, y := g.Centre(); !near(x, 34.02) || !near(y, 60.48) {
+		t.Errorf("centre is %v, %v", x, y)
+	}
+	if px, py := g.CentrePixel(); px != 720 || py != 1280 {
+		t.Errorf("centre pixel is %v, %v", px, py)
+	}
+
+	if x, y := g.PixelToMM(100, 200); !near(x, 4.725) || !near(y, 9.45) {
+		t.Errorf("PixelToMM gave %v, %v", x, y)
+	}
+	if px, py := g.MMToPixel(g.PixelToMM(100, 200)); !near(px, 100) || !near(py, 200) {
+		t.Errorf("MMToPixel gave %v, %v", px, py)
+	}
+	if px, py := g.PixelAt(0.04, -0.01); px != 0 || py != -1 {
+		t.Errorf("PixelAt gave %v, %v", px, py)
+	}
+
+	for idx, z := range map[int]float64{-1: 0, 0: 0.05, 3: 0.2, 5: 0.3} {
+		if got := g.LayerZ(idx); !near(got, z) {
+			t.Errorf("LayerZ(%d) is %v, expected %v", idx, got, z)
+		}
+	}
+	for z, idx := range map[float64]int{-5: 0, 0.06: 0, 0.08: 1, 0.1: 1, 9: 3} {
+		if got := g.LayerAt(z); got != idx {
+			t.Errorf("LayerAt(%v) is %d, expected %d", z, got, idx)
+		}
+	}
+
+	// No plate, screen or layers.
+	g = (&PhotonFile{LayerThickness: 0.05}).Geometry()
+	if px, py := g.MMToPixel(1, 1); px != 0 || py != 0 || g.PitchX != 0 {
+		t.Errorf("empty geometry gave %v, %v", px, py)
+	}
+	if g.LayerAt(1) != -1 || !near(g.LayerZ(0), 0.05) {
+		t.Errorf("empty geometry has layers")
+	}
+}
@@ -0,0 +1,333 @@
+package photon
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A single field of an inspected section.
+type InspectField struct {
+	Name    string `json:"name"`
+	Offset  int64  `json:"offset"` // Absolute offset within the file.
+	Size    int64  `json:"size"`
+	Raw     uint64 `json:"raw"`               // The little endian value as stored, floats as their bits.
+	Value   string `json:"value"`             // What the value means.
+	Unknown bool   `json:"unknown,omitempty"` // Set for fields we don't understand yet.
+}
+
+// A section of an inspected file, either made of fields or of smaller sections.
+type InspectSection struct {
+	Name     string           `json:"name"`
+	Offset   int64            `json:"offset"`
+	Size     int64            `json:"size"`
+	Value    string           `json:"value,omitempty"` // What a section without fields holds, e.g. the machine name.
+	Fields   []InspectField   `json:"fields,omitempty"`
+	Sections []InspectSection `json:"sections,omitempty"`
+}
+
+// A range of bytes flagged by Inspect.
+type InspectRange struct {
+	Offset   int64    `json:"offset"`
+	Size     int64    `json:"size"`
+	Sections []string `json:"sections,omitempty"` // The sections either side of a gap, or involved in an overlap.
+}
+
+// Inspection is an annotated map of a file, as returned by Inspect.
+type Inspection struct {
+	Size     int64            `json:"size"`
+	Sections []InspectSection `json:"sections"` // In file order.
+
+	Gaps     []InspectRange `json:"gaps,omitempty"`     // Bytes that no section accounts for.
+	Overlaps []InspectRange `json:"overlaps,omitempty"` // Bytes claimed by more than one section.
+
+	// Sections that couldn't be read, and anything else wrong with the file.
+	Problems []string `json:"problems,omitempty"`
+}
+
+// Maps out every section and field of a file, for working out what's in files from
+// new slicers and firmware. Only the main header has to be readable, anything else
+// wrong with the file is listed in Problems rather than returned as an error.
+// Layer image data is located but not decoded.
+func Inspect(rdr io.ReadSeeker) (*Inspection, error) {
+	sr, err := newSectionReader(rdr)
+	if err != nil {
+		return nil, err
+	}
+
+	ins := &Inspection{Size: sr.size}
+	problem := func(err error) {
+		ins.Problems = append(ins.Problems, err.Error())
+	}
+
+	// Read main file header
+	var header binCompatFileHeader
+	err = sr.read("header", 0, &header)
+	if err != nil {
+		return nil, err
+	}
+
+	version := "version " + strconv.FormatUint(uint64(header.Magic2), 10)
+	magic := "Chitu D series magic"
+	if header.Magic1 != headerMagic {
+		magic = "unknown magic"
+		problem(&FormatError{Section: "header", Offset: 0, Err: ErrBadMagic})
+	}
+	if header.Magic2 != Version1 && header.Magic2 != Version2 {
+		version += " (unsupported)"
+		problem(&FormatError{Section: "header", Offset: 4, Err: ErrUnsupportedVersion})
+	}
+
+	// The version 2 fields are unknown in version 1 files.
+	headerUnknown := map[string]bool{}
+	if header.Magic2 < Version2 {
+		headerUnknown["PrintParametersOffset"] = true
+		headerUnknown["PrintParametersSize"] = true
+		headerUnknown["AntiAliasLevel"] = true
+		headerUnknown["MachineInfoOffset"] = true
+	}
+	ins.Sections = append(ins.Sections, inspectSection("header", 0, header, headerUnknown, map[string]string{
+		"Magic1":          magic,
+		"Magic2":          version,
+		"LightCuringType": LightCuringType(header.LightCuringType).String(),
+	}))
+
+	// Previews
+	inspectPreview := func(name string, offset int64) {
+		var preview binCompatPreviewHeader
+		err := sr.read(name+" header", offset, &preview)
+		if err != nil {
+			problem(err)
+			return
+		}
+		ins.Sections = append(ins.Sections, inspectSection(name+" header", offset, preview, nil, nil))
+
+		err = sr.check(name+" data", int64(preview.PreviewDataOffset), uint64(preview.PreviewDataSize))
+		if err != nil {
+			problem(err)
+			return
+		}
+		ins.Sections = append(ins.Sections, InspectSection{
+			Name:   name + " data",
+			Offset: int64(preview.PreviewDataOffset),
+			Size:   int64(preview.PreviewDataSize),
+			Value:  fmt.Sprintf("%dx%d RGB5515 run length encoded image", preview.Width, preview.Height),
+		})
+	}
+	inspectPreview("preview", int64(header.PreviewHeaderOffset))
+	inspectPreview("thumbnail", int64(header.PreviewThumbnailHeaderOffset))
+
+	// Print parameters, machine info and name
+	if header.Magic2 >= Version2 && header.PrintParametersOffset != 0 {
+		var printParams binCompatPrintParameters
+		err = sr.read("print parameters", int64(header.PrintParametersOffset), &printParams)
+		if err != nil {
+			problem(err)
+		} else {
+			ins.Sections = append(ins.Sections, inspectSection("print parameters", int64(header.PrintParametersOffset), printParams, nil, nil))
+		}
+	}
+
+	if header.Magic2 >= Version2 && header.MachineInfoOffset != 0 {
+		var machineInfo binCompatMachineInfo
+		name, _, err := sr.readMachineInfo(int64(header.MachineInfoOffset), &machineInfo)
+		if err != nil {
+			problem(err)
+		} else {
+			ins.Sections = append(ins.Sections,
+				inspectSection("machine info", int64(header.MachineInfoOffset), machineInfo, nil, nil),
+				InspectSection{
+					Name:   "machine name",
+					Offset: int64(machineInfo.MachineNameOffset),
+					Size:   int64(machineInfo.MachineNameSize),
+					Value:  strconv.Quote(name),
+				},
+			)
+		}
+	}
+
+	// Layer headers, one table per anti-aliasing level, and the data they point at.
+	levels := uint32(1)
+	if header.Magic2 >= Version2 && header.AntiAliasLevel > 1 {
+		levels = header.AntiAliasLevel
+	}
+	if levels > maxAntiAliasLevel {
+		problem(&FormatError{Section: "header", Offset: 0x5C, Err: ErrTooLarge})
+		levels = 1
+	}
+
+	layerHeaderSize := int64(binary.Size(binCompatLayerHeader{}))
+	totalLayerHeaders := uint64(header.TotalLayers) * uint64(levels)
+	err = sr.check("layer headers", int64(header.LayerHeadersOffset), totalLayerHeaders*uint64(layerHeaderSize))
+	if err != nil {
+		problem(err)
+		totalLayerHeaders = 0
+	}
+	layerHeaders := make([]binCompatLayerHeader, totalLayerHeaders)
+	if totalLayerHeaders > 0 {
+		err = sr.read("layer headers", int64(header.LayerHeadersOffset), &layerHeaders)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	headersSection := InspectSection{
+		Name:   "layer headers",
+		Offset: int64(header.LayerHeadersOffset),
+		Size:   int64(len(layerHeaders)) * layerHeaderSize,
+		Value:  fmt.Sprintf("%d layers, %d tables", header.TotalLayers, levels),
+	}
+	dataSection := InspectSection{Name: "layer data"}
+	dataUsers := make(map[layerDataSpan]int)
+	for idx, layer := range layerHeaders {
+		offset := int64(header.LayerHeadersOffset) + int64(idx)*layerHeaderSize
+		dataOffset := layer.dataOffset(offset + layerHeaderSize)
+		name := strings.TrimSuffix(layerDataSection(idx, header.TotalLayers), " data")
+
+		imageDataOffset := fmt.Sprintf("0x%X", dataOffset)
+		if layer.ImageDataOffset&layerOffsetRelative != 0 {
+			imageDataOffset = fmt.Sprintf("0x%X relative to the end of this header, 0x%X", layer.ImageDataOffset&layerOffsetMask, dataOffset)
+		}
+		headersSection.Sections = append(headersSection.Sections, inspectSection(name+" header", offset, layer, nil, map[string]string{
+			"ImageDataOffset": imageDataOffset,
+		}))
+
+		// Layers sharing their image data only get one data section.
+		span := layerDataSpan{dataOffset, layer.ImageDataSize}
+		dataUsers[span]++
+		if dataUsers[span] > 1 {
+			continue
+		}
+
+		err = sr.check(name+" data", dataOffset, uint64(layer.ImageDataSize))
+		if err != nil {
+			problem(err)
+			continue
+		}
+		dataSection.Sections = append(dataSection.Sections, InspectSection{
+			Name:   name + " data",
+			Offset: dataOffset,
+			Size:   int64(layer.ImageDataSize),
+		})
+	}
+
+	ins.Sections = append(ins.Sections, headersSection)
+	if len(dataSection.Sections) > 0 {
+		start, end := dataSection.Sections[0].Offset, int64(0)
+		for i, s := range dataSection.Sections {
+			if s.Offset < start {
+				start = s.Offset
+			}
+			if s.Offset+s.Size > end {
+				end = s.Offset + s.Size
+			}
+
+			dataSection.Sections[i].Value = "run length encoded layer image"
+			if users := dataUsers[layerDataSpan{s.Offset, uint32(s.Size)}]; users > 1 {
+				dataSection.Sections[i].Value += fmt.Sprintf(", shared by %d layer headers", users)
+			}
+		}
+		dataSection.Offset = start
+		dataSection.Size = end - start
+		ins.Sections = append(ins.Sections, dataSection)
+	}
+
+	sort.SliceStable(ins.Sections, func(i, j int) bool {
+		return ins.Sections[i].Offset < ins.Sections[j].Offset
+	})
+	ins.findGaps()
+
+	return ins, nil
+}
+
+// inspectSection lists the fields of one of the binCompat structs, read from the given offset.
+// Fields named Field_XX, and those in unknown, are flagged as unknown. values overrides
+// the description of the named fields.
+func inspectSection(name string, offset int64, data interface{}, unknown map[string]bool, values map[string]string) InspectSection {
+	section := InspectSection{
+		Name:   name,
+		Offset: offset,
+		Size:   int64(binary.Size(data)),
+	}
+
+	v := reflect.ValueOf(data)
+	pos := offset
+	for i := 0; i < v.NumField(); i++ {
+		fv := v.Field(i)
+		field := InspectField{
+			Name:    v.Type().Field(i).Name,
+			Offset:  pos,
+			Size:    int64(fv.Type().Size()),
+			Unknown: strings.HasPrefix(v.Type().Field(i).Name, "Field_") || unknown[v.Type().Field(i).Name],
+		}
+
+		switch fv.Kind() {
+		case reflect.Float32:
+			field.Raw = uint64(math.Float32bits(float32(fv.Float())))
+			field.Value = strconv.FormatFloat(fv.Float(), 'g', -1, 32)
+		default:
+			field.Raw = fv.Uint()
+			field.Value = strconv.FormatUint(field.Raw, 10)
+			if strings.HasSuffix(field.Name, "Offset") {
+				field.Value = fmt.Sprintf("0x%X", field.Raw)
+			}
+		}
+		if value, ok := values[field.Name]; ok {
+			field.Value = value
+		}
+
+		section.Fields = append(section.Fields, field)
+		pos += field.Size
+	}
+
+	return section
+}
+
+// findGaps flags the bytes between sections, and those covered by more than one.
+func (ins *Inspection) findGaps() {
+	// Only the innermost sections count, the others just group them.
+	var leaves []InspectSection
+	var addLeaves func(sections []InspectSection)
+	addLeaves = func(sections []InspectSection) {
+		for _, s := range sections {
+			if len(s.Sections) > 0 {
+				addLeaves(s.Sections)
+			} else if s.Size > 0 {
+				leaves = append(leaves, s)
+			}
+		}
+	}
+	addLeaves(ins.Sections)
+
+	sort.SliceStable(leaves, func(i, j int) bool {
+		return leaves[i].Offset < leaves[j].Offset
+	})
+
+	end := int64(0)
+	last := ""
+	for _, s := range leaves {
+		if s.Offset > end {
+			ins.Gaps = append(ins.Gaps, InspectRange{Offset: end, Size: s.Offset - end, Sections: []string{last, s.Name}})
+		} else if s.Offset < end {
+			overlapEnd := end
+			if s.Offset+s.Size < overlapEnd {
+				overlapEnd = s.Offset + s.Size
+			}
+			ins.Overlaps = append(ins.Overlaps, InspectRange{Offset: s.Offset, Size: overlapEnd - s.Offset, Sections: []string{last, s.Name}})
+		}
+
+		if s.Offset+s.Size > end {
+			end = s.Offset + s.Size
+			last = s.Name
+		}
+	}
+
+	if ins.Size > end {
+		ins.Gaps = append(ins.Gaps, InspectRange{Offset: end, Size: ins.Size - end, Sections: []string{last}})
+	}
+}
@@ -0,0 +1,112 @@
+package photon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// inspectTest inspects data, failing the test if Inspect can't.
+func inspectTest(t *testing.T, data []byte) *Inspection {
+	ins, err := Inspect(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ins
+}
+
+// findField returns the named field of a section.
+func findField(t *testing.T, s InspectSection, name string) InspectField {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	t.Fatalf("%s has no field %s", s.Name, name)
+	return InspectField{}
+}
+
+func TestInspect(t *testing.T) {
+	data := encodeTest(t, testFile(t, Version2, 0))
+	ins := inspectTest(t, data)
+
+	var names []string
+	for _, s := range ins.Sections {
+		names = append(names, s.Name)
+	}
+	expected := []string{"header", "preview header", "preview data", "thumbnail header", "thumbnail data",
+		"print parameters", "machine info", "machine name", "layer headers", "layer data"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("sections are %q, expected %q", names, expected)
+	}
+	if ins.Size != int64(len(data)) || len(ins.Gaps) != 0 || len(ins.Overlaps) != 0 || len(ins.Problems) != 0 {
+		t.Errorf("clean file has gaps %v, overlaps %v and problems %q", ins.Gaps, ins.Overlaps, ins.Problems)
+	}
+
+	header := ins.Sections[0]
+	width := findField(t, header, "ScreenWidth")
+	if width.Offset != 0x38 || width.Size != 4 || width.Raw != 40 || width.Unknown {
+		t.Errorf("ScreenWidth is %+v", width)
+	}
+	if !findField(t, header, "Field_14").Unknown || findField(t, header, "PrintParametersOffset").Unknown {
+		t.Error("header fields flagged wrongly")
+	}
+	if name := ins.Sections[7]; name.Value != `"Test Printer"` || uint64(name.Offset) != findField(t, ins.Sections[6], "MachineNameOffset").Raw {
+		t.Errorf("machine name section is %+v", name)
+	}
+
+	// Layers 4 and 5 share their data.
+	headers, layerData := ins.Sections[8], ins.Sections[9]
+	if len(headers.Sections) != 6 || len(layerData.Sections) != 5 {
+		t.Fatalf("%d layer headers point at %d data sections", len(headers.Sections), len(layerData.Sections))
+	}
+	if last := layerData.Sections[4]; !strings.Contains(last.Value, "shared by 2") {
+		t.Errorf("last layer data is %q", last.Value)
+	}
+	if end := layerData.Offset + layerData.Size; end != int64(len(data)) {
+		t.Errorf("layer data ends at 0x%X, the file at 0x%X", end, len(data))
+	}
+
+	v1 := inspectTest(t, encodeTest(t, testFile(t, Version1, 0)))
+	if !findField(t, v1.Sections[0], "PrintParametersOffset").Unknown {
+		t.Error("PrintParametersOffset isn't flagged unknown in a version 1 file")
+	}
+}
+
+func TestInspectGaps(t *testing.T) {
+	pf := testCases[4].pf(t)
+	data := encodeTest(t, pf)
+	ins := inspectTest(t, data)
+
+	// The padding before the preview header, and the trailer.
+	first, last := ins.Gaps[0], ins.Gaps[len(ins.Gaps)-1]
+	if first.Size != 4 || !reflect.DeepEqual(first.Sections, []string{"header", "preview header"}) {
+		t.Errorf("first gap is %+v", first)
+	}
+	if last.Size != int64(len(pf.Layout.Trailer)) || last.Offset+last.Size != int64(len(data)) {
+		t.Errorf("last gap is %+v", last)
+	}
+	if len(ins.Overlaps) != 0 || len(ins.Problems) != 0 {
+		t.Errorf("padded file has overlaps %v and problems %q", ins.Overlaps, ins.Problems)
+	}
+}
+
+func TestInspectDamaged(t *testing.T) {
+	data := encodeTest(t, testFile(t, Version1, 0))
+	layerHeadersOffset := binary.LittleEndian.Uint32(data[0x40:])
+
+	// Layer 1 starts a byte into layer 0's data, layer 2 runs off the end of the file.
+	layer0 := data[layerHeadersOffset:]
+	binary.LittleEndian.PutUint32(data[layerHeadersOffset+36+0x0C:], binary.LittleEndian.Uint32(layer0[0x0C:])+1)
+	binary.LittleEndian.PutUint32(data[layerHeadersOffset+2*36+0x10:], uint32(len(data)))
+
+	ins := inspectTest(t, data)
+	if len(ins.Overlaps) == 0 || !reflect.DeepEqual(ins.Overlaps[0].Sections, []string{"layer 0 data", "layer 1 data"}) {
+		t.Errorf("overlaps are %+v", ins.Overlaps)
+	}
+	if len(ins.Problems) != 1 || !strings.Contains(ins.Problems[0], "layer 2 data") {
+		t.Errorf("problems are %q", ins.Problems)
+	}
+}
@@ -1,6 +1,7 @@
 package photon
 
 import (
+	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
@@ -52,10 +53,14 @@ func decodeLayerImageData(imageData []byte, screenHeight uint32, screenWidth uin
 }
 
 func encodeLayerImageData(img *image.RGBA) []byte {
-	var output []byte
+	return encodeLayerBitmap(img.Bounds().Max.X, img.Bounds().Max.Y, func(x int, y int) bool {
+		return img.At(x, y) == PixelSetColor
+	})
+}
 
-	var screenHeight = img.Bounds().Max.Y
-	var screenWidth = img.Bounds().Max.X
+// encodeLayerBitmap RLE encodes a screenWidth*screenHeight bitmap, column by column.
+func encodeLayerBitmap(screenWidth int, screenHeight int, isSet func(x int, y int) bool) []byte {
+	var output []byte
 
 	var unsetCount uint8 = 0
 	var setCount uint8 = 0
@@ -66,7 +71,7 @@ func encodeLayerImageData(img *image.RGBA) []byte {
 		y := pixelIndex % screenHeight
 		x := pixelIndex / screenHeight
 
-		if img.At(x, y) == PixelUnsetColor {
+		if !isSet(x, y) {
 			if setCount != 0 {
 				// Previous pixels were set, this was not.
 				output = append(output, setCount|FLAG_SET_PIXELS)
@@ -78,7 +83,7 @@ func encodeLayerImageData(img *image.RGBA) []byte {
 				output = append(output, unsetCount)
 				unsetCount = 0
 			}
-		} else if img.At(x, y) == PixelSetColor {
+		} else {
 			if unsetCount != 0 {
 				// Previous pixels were unset, this was not.
 				output = append(output, unsetCount)
@@ -108,3 +113,101 @@ func encodeLayerImageData(img *image.RGBA) []byte {
 
 	return output
 }
+
+// countLayerImageData adds one to the count of every pixel set in the image data.
+// counts is indexed by y*screenWidth+x.
+func countLayerImageData(counts []uint8, imageData []byte, screenHeight uint32, screenWidth uint32) {
+	maxPixelIndex := screenHeight * screenWidth
+
+	pixelIndex := uint32(0)
+	for i := 0; i < len(imageData) && pixelIndex < maxPixelIndex; i++ {
+		val := uint32(imageData[i] & 0x7F)
+
+		if imageData[i]&FLAG_SET_PIXELS == 0 {
+			pixelIndex += val
+			continue
+		}
+
+		for j := uint32(0); j < val && pixelIndex < maxPixelIndex; j++ {
+			y := pixelIndex % screenHeight
+			x := pixelIndex / screenHeight
+
+			counts[y*screenWidth+x]++
+			pixelIndex++
+		}
+	}
+}
+
+// layerImageDataPixels returns how many pixels (set or not) the RLE image data covers.
+func layerImageDataPixels(imageData []byte) uint64 {
+	pixels := uint64(0)
+	for _, b := range imageData {
+		pixels += uint64(b & 0x7F)
+	}
+	return pixels
+}
+
+// Decodes the given layer into a grayscale image, combining all of its anti-aliasing levels.
+// The image is in real-world orientation, i.e. any mirroring needed by the Projection is undone.
+func (pf *PhotonFile) LayerImage(layerIdx int) (*image.Gray, error) {
+	if layerIdx < 0 || layerIdx >= len(pf.Layers) {
+		return nil, fmt.Errorf("photon: layer %d out of range", layerIdx)
+	}
+	layer := pf.Layers[layerIdx]
+
+	img := image.NewGray(image.Rect(0, 0, int(pf.ScreenWidth), int(pf.ScreenHeight)))
+	countLayerImageData(img.Pix, layer.RawData, pf.ScreenHeight, pf.ScreenWidth)
+	for _, data := range layer.AntiAliasRawData {
+		countLayerImageData(img.Pix, data, pf.ScreenHeight, pf.ScreenWidth)
+	}
+
+	levels := len(layer.AntiAliasRawData) + 1
+	for i, count := range img.Pix {
+		img.Pix[i] = uint8(int(count) * 0xFF / levels)
+	}
+
+	if pf.Projection().MirrorX() {
+		for y := 0; y < int(pf.ScreenHeight); y++ {
+			row := img.Pix[y*img.Stride : y*img.Stride+int(pf.ScreenWidth)]
+			for i, j := 0, len(row)-1; i < j; i, j = i+1, j-1 {
+				row[i], row[j] = row[j], row[i]
+			}
+		}
+	}
+
+	return img, nil
+}
+
+// Encodes a grayscale image into the given layer, writing one bitmap per anti-aliasing level.
+// Each level is set where the pixel is brighter than that level's share of the range.
+// The image is taken to be in real-world orientation, as returned by LayerImage, and
+// is mirrored if the Projection needs it.
+func (pf *PhotonFile) SetLayerImage(layerIdx int, img *image.Gray) error {
+	if layerIdx < 0 || layerIdx >= len(pf.Layers) {
+		return fmt.Errorf("photon: layer %d out of range", layerIdx)
+	}
+	if img.Bounds() != image.Rect(0, 0, int(pf.ScreenWidth), int(pf.ScreenHeight)) {
+		return fmt.Errorf("photon: layer image is %v, expected %vx%v", img.Bounds().Size(), pf.ScreenWidth, pf.ScreenHeight)
+	}
+
+	levels := 1
+	if pf.Version >= Version2 && pf.AntiAliasLevel > 1 {
+		levels = int(pf.AntiAliasLevel)
+	}
+
+	var levelData [][]byte
+	for level := 0; level < levels; level++ {
+		levelData = append(levelData, encodeLayerBitmap(int(pf.ScreenWidth), int(pf.ScreenHeight), func(x int, y int) bool {
+			count := (int(img.GrayAt(pf.layerX(x), y).Y)*levels + 0x7F) / 0xFF
+			return count > level
+		}))
+	}
+
+	pf.Layers[layerIdx].RawData = levelData[0]
+	pf.Layers[layerIdx].AntiAliasRawData = levelData[1:]
+	if levels == 1 {
+		pf.Layers[layerIdx].AntiAliasRawData = nil
+	}
+
+	return nil
+}
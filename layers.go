@@ -0,0 +1,193 @@
+package photon
+
+import "fmt"
+
+/*
+The layer editing methods keep the file consistent as layers come and go:
+
+Every layer is either a bottom layer or a normal one, and the first BottomLayers
+layers are the bottom ones. Edits keep each existing layer's kind: deleting a bottom
+layer leaves one less of them, and so on. A layer that still ends up on the wrong
+side of BottomLayers (e.g. a normal layer moved to the bottom) gets the file's
+exposure time for where it is now, the rest keep their own exposure times.
+
+AbsoluteHeight is recomputed for every layer from LayerThickness, starting at the
+height of the first layer before the edit, or at LayerThickness if there were no
+layers (as Geometry.LayerZ has it).
+*/
+
+// Inserts layers so that the first of them ends up at index at. They are bottom layers if
+// inserted among the existing bottom layers. Zero ExposureTime and PerLayerOffTime are
+// filled in from the file's settings.
+func (pf *PhotonFile) InsertLayers(at int, layers ...Layer) error {
+	if at < 0 || at > len(pf.Layers) {
+		return fmt.Errorf("photon: insert position %d out of range", at)
+	}
+
+	isBottom := at < pf.existingBottomLayers()
+
+	newLayers := make([]Layer, 0, len(pf.Layers)+len(layers))
+	newLayers = append(newLayers, pf.Layers[:at]...)
+	newLayers = append(newLayers, layers...)
+	newLayers = append(newLayers, pf.Layers[at:]...)
+
+	bottom := pf.bottomLayerMask()
+	newBottom := make([]bool, 0, len(newLayers))
+	newBottom = append(newBottom, bottom[:at]...)
+	for range layers {
+		newBottom = append(newBottom, isBottom)
+	}
+	newBottom = append(newBottom, bottom[at:]...)
+
+	pf.editLayers(newLayers, newBottom)
+	return nil
+}
+
+// Deletes the layers from index from up to (but not including) index to.
+func (pf *PhotonFile) DeleteLayers(from int, to int) error {
+	err := pf.checkLayerRange(from, to)
+	if err != nil {
+		return err
+	}
+
+	newLayers := append(append([]Layer(nil), pf.Layers[:from]...), pf.Layers[to:]...)
+
+	bottom := pf.bottomLayerMask()
+	newBottom := append(append([]bool(nil), bottom[:from]...), bottom[to:]...)
+
+	pf.editLayers(newLayers, newBottom)
+	return nil
+}
+
+// Moves the layers from index from up to (but not including) index to, so that the first
+// of them ends up at index dest. dest counts the layers after the moved ones are taken out,
+// so it can be at most len(pf.Layers)-(to-from).
+func (pf *PhotonFile) MoveLayers(from int, to int, dest int) error {
+	err := pf.checkLayerRange(from, to)
+	if err != nil {
+		return err
+	}
+	if dest < 0 || dest > len(pf.Layers)-(to-from) {
+		return fmt.Errorf("photon: move destination %d out of range", dest)
+	}
+
+	// Work out where each layer comes from, then shuffle them into place.
+	var order []int
+	for i := range pf.Layers {
+		if i < from || i >= to {
+			order = append(order, i)
+		}
+	}
+	var moved []int
+	for i := from; i < to; i++ {
+		moved = append(moved, i)
+	}
+	order = append(order[:dest], append(moved, order[dest:]...)...)
+
+	bottom := pf.bottomLayerMask()
+	newLayers := make([]Layer, len(order))
+	newBottom := make([]bool, len(order))
+	for i, idx := range order {
+		newLayers[i] = pf.Layers[idx]
+		newBottom[i] = bottom[idx]
+	}
+
+	pf.editLayers(newLayers, newBottom)
+	return nil
+}
+
+// Inserts count copies of the given layer right after it. The copies are the same kind
+// of layer as the original, and share its image data.
+func (pf *PhotonFile) DuplicateLayer(layerIdx int, count int) error {
+	if layerIdx < 0 || layerIdx >= len(pf.Layers) {
+		return fmt.Errorf("photon: layer %d out of range", layerIdx)
+	}
+	if count < 0 {
+		return fmt.Errorf("photon: can't make %d copies of a layer", count)
+	}
+
+	bottom := pf.bottomLayerMask()
+
+	newLayers := make([]Layer, 0, len(pf.Layers)+count)
+	newLayers = append(newLayers, pf.Layers[:layerIdx+1]...)
+	newBottom := make([]bool, 0, len(pf.Layers)+count)
+	newBottom = append(newBottom, bottom[:layerIdx+1]...)
+	for i := 0; i < count; i++ {
+		layer := pf.Layers[layerIdx]
+		layer.AntiAliasRawData = append([][]byte(nil), layer.AntiAliasRawData...)
+		newLayers = append(newLayers, layer)
+		newBottom = append(newBottom, bottom[layerIdx])
+	}
+	newLayers = append(newLayers, pf.Layers[layerIdx+1:]...)
+	newBottom = append(newBottom, bottom[layerIdx+1:]...)
+
+	pf.editLayers(newLayers, newBottom)
+	return nil
+}
+
+// checkLayerRange checks that [from, to) is a valid range of layers.
+func (pf *PhotonFile) checkLayerRange(from int, to int) error {
+	if from < 0 || to > len(pf.Layers) || from > to {
+		return fmt.Errorf("photon: layer range [%d, %d) out of range", from, to)
+	}
+	return nil
+}
+
+// existingBottomLayers returns how many of the layers are bottom layers,
+// BottomLayers may be more than there are layers.
+func (pf *PhotonFile) existingBottomLayers() int {
+	if int64(pf.BottomLayers) > int64(len(pf.Layers)) {
+		return len(pf.Layers)
+	}
+	return int(pf.BottomLayers)
+}
+
+// bottomLayerMask returns whether each layer is a bottom layer.
+func (pf *PhotonFile) bottomLayerMask() []bool {
+	bottom := make([]bool, len(pf.Layers))
+	for i := 0; i < pf.existingBottomLayers(); i++ {
+		bottom[i] = true
+	}
+	return bottom
+}
+
+// editLayers replaces the layers with the edited ones, where bottom says whether each was a bottom
+// layer. It updates BottomLayers, exposure times and heights to match, as described above.
+func (pf *PhotonFile) editLayers(layers []Layer, bottom []bool) {
+	baseHeight := float64(pf.LayerThickness)
+	if len(pf.Layers) > 0 {
+		baseHeight = float64(pf.Layers[0].AbsoluteHeight)
+	}
+
+	newBottomLayers := 0
+	for _, b := range bottom {
+		if b {
+			newBottomLayers++
+		}
+	}
+
+	oldBottomLayers := pf.BottomLayers
+	pf.BottomLayers = uint32(int64(pf.BottomLayers) - int64(pf.existingBottomLayers()) + int64(newBottomLayers))
+	if pf.PrintParameters.BottomLayers == oldBottomLayers {
+		pf.PrintParameters.BottomLayers = pf.BottomLayers
+	}
+
+	for idx := range layers {
+		l := &layers[idx]
+
+		isBottom := uint32(idx) < pf.BottomLayers
+		if isBottom != bottom[idx] || l.ExposureTime == 0 {
+			l.ExposureTime = pf.NormalExposureTime
+			if isBottom {
+				l.ExposureTime = pf.BottomExposureTime
+			}
+		}
+		if l.PerLayerOffTime == 0 {
+			l.PerLayerOffTime = pf.OffTime
+		}
+
+		l.AbsoluteHeight = float32(baseHeight + float64(idx)*float64(pf.LayerThickness))
+	}
+
+	pf.Layers = layers
+}
@@ -0,0 +1,137 @@
+package photon
+
+import (
+	"math"
+	"testing"
+)
+
+// editTestFile makes a file with 5 layers, the first 2 of them bottom layers.
+// Each layer's RawData is just its original index.
+func editTestFile(t *testing.T) *PhotonFile {
+	pf := New(Profile{Version: Version2, ScreenWidth: 40, ScreenHeight: 30, PlateX: 68, PlateY: 120, PlateZ: 150, BottomLayers: 2})
+	var layers []Layer
+	for i := 0; i < 5; i++ {
+		layers = append(layers, Layer{RawData: []byte{byte(i)}})
+	}
+	err := pf.InsertLayers(0, layers...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pf
+}
+
+// checkLayers checks the order of the layers, by their original index, and that
+// their exposure times and heights match the first bottomLayers being bottom layers.
+func checkLayers(t *testing.T, pf *PhotonFile, order []byte, bottomLayers uint32) {
+	t.Helper()
+
+	if pf.BottomLayers != bottomLayers || pf.PrintParameters.BottomLayers != bottomLayers {
+		t.Errorf("BottomLayers is %d (%d in the print parameters), expected %d", pf.BottomLayers, pf.PrintParameters.BottomLayers, bottomLayers)
+	}
+	if len(pf.Layers) != len(order) {
+		t.Fatalf("%d layers, expected %d", len(pf.Layers), len(order))
+	}
+
+	g := pf.Geometry()
+	for idx, l := range pf.Layers {
+		if l.RawData[0] != order[idx] {
+			t.Errorf("layer %d was layer %d, expected %d", idx, l.RawData[0], order[idx])
+		}
+
+		exposure := pf.NormalExposureTime
+		if uint32(idx) < bottomLayers {
+			exposure = pf.BottomExposureTime
+		}
+		if l.ExposureTime != exposure || l.PerLayerOffTime != pf.OffTime {
+			t.Errorf("layer %d has exposure %v and off time %v, expected %v and %v", idx, l.ExposureTime, l.PerLayerOffTime, exposure, pf.OffTime)
+		}
+
+		z := float64(idx+1) * float64(pf.LayerThickness)
+		if math.Abs(float64(l.AbsoluteHeight)-z) > 1e-6 || math.Abs(g.LayerZ(idx)-z) > 1e-6 {
+			t.Errorf("layer %d is at %v (%v from Geometry), expected %v", idx, l.AbsoluteHeight, g.LayerZ(idx), z)
+		}
+	}
+}
+
+func TestInsertLayers(t *testing.T) {
+	// Geometry and InsertLayers agree on where the first layer goes.
+	pf := New(Profile{ScreenWidth: 40, ScreenHeight: 30})
+	z := pf.Geometry().LayerZ(0)
+	err := pf.InsertLayers(0, Layer{RawData: []byte{0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if float64(pf.Layers[0].AbsoluteHeight) != float64(float32(z)) {
+		t.Errorf("first layer inserted at %v, Geometry expected %v", pf.Layers[0].AbsoluteHeight, z)
+	}
+
+	pf = editTestFile(t)
+	checkLayers(t, pf, []byte{0, 1, 2, 3, 4}, 2)
+
+	// Among the bottom layers, and after them.
+	err = pf.InsertLayers(1, Layer{RawData: []byte{5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLayers(t, pf, []byte{0, 5, 1, 2, 3, 4}, 3)
+	err = pf.InsertLayers(6, Layer{RawData: []byte{6}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLayers(t, pf, []byte{0, 5, 1, 2, 3, 4, 6}, 3)
+
+	if pf.InsertLayers(8, Layer{}) == nil || pf.InsertLayers(-1, Layer{}) == nil {
+		t.Error("inserted layers out of range")
+	}
+}
+
+func TestDeleteLayers(t *testing.T) {
+	pf := editTestFile(t)
+	err := pf.DeleteLayers(1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLayers(t, pf, []byte{0, 3, 4}, 1)
+
+	if pf.DeleteLayers(2, 1) == nil || pf.DeleteLayers(0, 4) == nil {
+		t.Error("deleted layers out of range")
+	}
+}
+
+func TestMoveLayers(t *testing.T) {
+	// A normal layer moved to the bottom stays a normal layer, but gets
+	// the bottom exposure time for where it is now.
+	pf := editTestFile(t)
+	err := pf.MoveLayers(4, 5, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLayers(t, pf, []byte{4, 0, 1, 2, 3}, 2)
+
+	pf = editTestFile(t)
+	err = pf.MoveLayers(0, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLayers(t, pf, []byte{2, 3, 4, 0, 1}, 2)
+
+	if pf.MoveLayers(0, 2, 4) == nil || pf.MoveLayers(3, 6, 0) == nil {
+		t.Error("moved layers out of range")
+	}
+}
+
+func TestDuplicateLayer(t *testing.T) {
+	pf := editTestFile(t)
+	err := pf.DuplicateLayer(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLayers(t, pf, []byte{0, 1, 1, 1, 2, 3, 4}, 4)
+	if &pf.Layers[2].RawData[0] != &pf.Layers[1].RawData[0] {
+		t.Error("copies don't share the image data")
+	}
+
+	if pf.DuplicateLayer(7, 1) == nil || pf.DuplicateLayer(0, -1) == nil {
+		t.Error("duplicated a layer out of range")
+	}
+}
@@ -0,0 +1,248 @@
+package photon
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// A section of the file, other than the main header which always comes first.
+type Section int
+
+const (
+	SectionPreviewHeader Section = iota
+	SectionPreviewData
+	SectionThumbnailHeader
+	SectionThumbnailData
+	SectionPrintParameters // Version 2 only
+	SectionMachineInfo     // Version 2 only, optional
+	SectionMachineName     // Version 2 only, optional
+	SectionLayerHeaders    // All of the layer header tables
+	SectionLayerData       // All of the layer image data
+
+	numSections
+)
+
+var sectionNames = [numSections]string{
+	"preview header",
+	"preview data",
+	"thumbnail header",
+	"thumbnail data",
+	"print parameters",
+	"machine info",
+	"machine name",
+	"layer headers",
+	"layer data",
+}
+
+func (s Section) String() string {
+	if s < 0 || s >= numSections {
+		return fmt.Sprintf("Section(%d)", int(s))
+	}
+	return sectionNames[s]
+}
+
+type LayoutSection struct {
+	Section Section
+	Padding []byte // Written just before the section.
+}
+
+// Layout describes how EncodeTo arranges a file: the order of its sections,
+// the padding between them and the values used for the unknown header fields.
+//
+// Decode records the layout of the file it read in PhotonFile.Layout, so
+// re-encoding reproduces it. To match the output of a particular slicer,
+// decode a file written by it and reuse that file's Layout.
+type Layout struct {
+	// Every Section, once each. Sections the file doesn't have (e.g. the
+	// print parameters of a version 1 file) are skipped along with their padding.
+	// SectionPrintParameters may be left out, for version 2 files without them.
+	Sections []LayoutSection
+
+	// Written after the last section.
+	Trailer []byte
+
+	// Whether layers with identical image data share a single copy of it.
+	DeduplicateLayerData bool
+
+	// Values for the unknown header fields, used in place of the PhotonFile's own when those are all zero.
+	HeaderExtra    FileHeaderExtra
+	PreviewExtra   PreviewHeaderExtra
+	ThumbnailExtra PreviewHeaderExtra
+}
+
+// The layout EncodeTo uses for files that don't have one.
+var DefaultLayout = Layout{
+	Sections: []LayoutSection{
+		{Section: SectionPreviewHeader},
+		{Section: SectionPreviewData},
+		{Section: SectionThumbnailHeader},
+		{Section: SectionThumbnailData},
+		{Section: SectionPrintParameters},
+		{Section: SectionMachineInfo},
+		{Section: SectionMachineName},
+		{Section: SectionLayerHeaders},
+		{Section: SectionLayerData},
+	},
+	DeduplicateLayerData: true,
+}
+
+// Padding longer than this between sections means we've probably misread the file,
+// so we don't try to reproduce its layout.
+const maxLayoutPadding = 1 << 16
+
+// check verifies that every section appears exactly once, other than the optional print parameters.
+func (l *Layout) check() error {
+	var seen [numSections]bool
+	for _, ls := range l.Sections {
+		if ls.Section < 0 || ls.Section >= numSections {
+			return fmt.Errorf("photon: layout has unknown section %v", ls.Section)
+		}
+		if seen[ls.Section] {
+			return fmt.Errorf("photon: layout has section %v more than once", ls.Section)
+		}
+		seen[ls.Section] = true
+	}
+
+	seen[SectionPrintParameters] = true
+	for _, ok := range seen {
+		if !ok {
+			return errors.New("photon: layout is missing sections")
+		}
+	}
+	return nil
+}
+
+// sectionSpan is where a section was found in a decoded file.
+type sectionSpan struct {
+	section Section
+	offset  int64
+	size    int64
+}
+
+// detectLayout works out the layout of a decoded file from where its sections are.
+// It returns nil if the sections overlap or are too far apart to reproduce.
+func detectLayout(sr *sectionReader, headerSize int64, spans []sectionSpan) *Layout {
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].offset < spans[j].offset
+	})
+
+	readGap := func(from int64, to int64) ([]byte, bool) {
+		if to < from || to-from > maxLayoutPadding {
+			return nil, false
+		}
+		if to == from {
+			return nil, true
+		}
+
+		gap := make([]byte, to-from)
+		err := sr.read("padding", from, &gap)
+		return gap, err == nil
+	}
+
+	layout := &Layout{}
+	var present [numSections]bool
+	pos := headerSize
+	for _, span := range spans {
+		padding, ok := readGap(pos, span.offset)
+		if !ok {
+			return nil
+		}
+
+		layout.Sections = append(layout.Sections, LayoutSection{Section: span.section, Padding: padding})
+		present[span.section] = true
+		pos = span.offset + span.size
+	}
+
+	trailer, ok := readGap(pos, sr.size)
+	if !ok {
+		return nil
+	}
+	layout.Trailer = trailer
+
+	// Slot in any sections the file doesn't have, right after where the default layout puts them.
+	for i, ds := range DefaultLayout.Sections {
+		if present[ds.Section] {
+			continue
+		}
+
+		insertAt := 0
+		for j := i - 1; j >= 0; j-- {
+			if idx := layout.index(DefaultLayout.Sections[j].Section); idx >= 0 {
+				insertAt = idx + 1
+				break
+			}
+		}
+
+		layout.Sections = append(layout.Sections, LayoutSection{})
+		copy(layout.Sections[insertAt+1:], layout.Sections[insertAt:])
+		layout.Sections[insertAt] = LayoutSection{Section: ds.Section}
+		present[ds.Section] = true
+	}
+
+	return layout
+}
+
+// index returns the position of the given section in the layout, or -1.
+func (l *Layout) index(s Section) int {
+	for i, ls := range l.Sections {
+		if ls.Section == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// detectLayerDataLayout checks that the unique layer data blocks are packed back to back in
+// the order they're first used, and returns the span they cover. It returns false otherwise.
+func detectLayerDataLayout(lt *layerTable) (sectionSpan, bool) {
+	span := sectionSpan{section: SectionLayerData}
+	seen := make(map[layerDataSpan]bool)
+	for idx, lh := range lt.headers {
+		ds := layerDataSpan{lt.dataOffsets[idx], lh.ImageDataSize}
+		if seen[ds] {
+			continue
+		}
+
+		if len(seen) == 0 {
+			span.offset = ds.offset
+		} else if ds.offset != span.offset+span.size {
+			return span, false
+		}
+
+		seen[ds] = true
+		span.size += int64(ds.size)
+	}
+
+	return span, true
+}
+
+// hasDuplicateLayerData reports whether any two distinct blocks of layer data have the same contents.
+func hasDuplicateLayerData(pf *PhotonFile) bool {
+	seen := make(map[[sha256.Size]byte][]byte)
+	check := func(data []byte) bool {
+		sum := sha256.Sum256(data)
+		other, ok := seen[sum]
+		if !ok {
+			seen[sum] = data
+			return false
+		}
+
+		// Shared (rather than duplicated) data is the same slice.
+		return len(data) > 0 && &other[0] != &data[0] && bytes.Equal(other, data)
+	}
+
+	for _, l := range pf.Layers {
+		if check(l.RawData) {
+			return true
+		}
+		for _, data := range l.AntiAliasRawData {
+			if check(data) {
+				return true
+			}
+		}
+	}
+	return false
+}
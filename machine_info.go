@@ -0,0 +1,95 @@
+package photon
+
+// Raw values of the unknown binCompatMachineInfo fields, named by their offset.
+type MachineInfoExtra struct {
+	Field_00 uint32
+	Field_04 uint32
+	Field_08 uint32
+	Field_0C uint32
+	Field_10 uint32
+	Field_14 uint32
+	Field_18 uint32
+	Field_24 uint32
+	Field_28 uint32
+	Field_2C uint32
+	Field_30 uint32
+	Field_34 uint32
+	Field_38 uint32
+	Field_3C uint32
+	Field_40 uint32
+	Field_44 uint32
+	Field_48 uint32
+}
+
+// Slicer/machine info block, only present in version 2 files.
+// The machine name itself is stored separately, right after this block.
+type binCompatMachineInfo struct {
+	Field_00          uint32
+	Field_04          uint32
+	Field_08          uint32
+	Field_0C          uint32
+	Field_10          uint32
+	Field_14          uint32
+	Field_18          uint32
+	MachineNameOffset uint32
+	MachineNameSize   uint32
+	Field_24          uint32
+	Field_28          uint32
+	Field_2C          uint32
+	Field_30          uint32
+	Field_34          uint32
+	Field_38          uint32
+	Field_3C          uint32
+	Field_40          uint32
+	Field_44          uint32
+	Field_48          uint32
+}
+
+// Longest machine name we'll read, anything longer is treated as corrupt.
+const maxMachineNameSize = 1024
+
+func (mi binCompatMachineInfo) extra() MachineInfoExtra {
+	return MachineInfoExtra{
+		Field_00: mi.Field_00,
+		Field_04: mi.Field_04,
+		Field_08: mi.Field_08,
+		Field_0C: mi.Field_0C,
+		Field_10: mi.Field_10,
+		Field_14: mi.Field_14,
+		Field_18: mi.Field_18,
+		Field_24: mi.Field_24,
+		Field_28: mi.Field_28,
+		Field_2C: mi.Field_2C,
+		Field_30: mi.Field_30,
+		Field_34: mi.Field_34,
+		Field_38: mi.Field_38,
+		Field_3C: mi.Field_3C,
+		Field_40: mi.Field_40,
+		Field_44: mi.Field_44,
+		Field_48: mi.Field_48,
+	}
+}
+
+func (e MachineInfoExtra) toBinCompat(nameOffset uint32, nameSize uint32) binCompatMachineInfo {
+	return binCompatMachineInfo{
+		Field_00:          e.Field_00,
+		Field_04:          e.Field_04,
+		Field_08:          e.Field_08,
+		Field_0C:          e.Field_0C,
+		Field_10:          e.Field_10,
+		Field_14:          e.Field_14,
+		Field_18:          e.Field_18,
+		MachineNameOffset: nameOffset,
+		MachineNameSize:   nameSize,
+		Field_24:          e.Field_24,
+		Field_28:          e.Field_28,
+		Field_2C:          e.Field_2C,
+		Field_30:          e.Field_30,
+		Field_34:          e.Field_34,
+		Field_38:          e.Field_38,
+		Field_3C:          e.Field_3C,
+		Field_40:          e.Field_40,
+		Field_44:          e.Field_44,
+		Field_48:          e.Field_48,
+	}
+}
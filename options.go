@@ -0,0 +1,86 @@
+package photon
+
+import (
+	"context"
+	"io"
+)
+
+// Options for DecodeWithOptions. The zero value decodes exactly like Decode.
+type DecodeOptions struct {
+	// Limits on what the file may contain, zero means the decoder's default.
+	// Files over a limit fail with a *FormatError wrapping ErrTooLarge.
+	MaxLayers     uint32 // Number of layers.
+	MaxScreenSize uint32 // Width and height of the screen, in pixels.
+	MaxTotalBytes uint64 // Total size of the layer image data.
+
+	// Called as the layer images are read with how many have been read so far, from 0
+	// up to total. Anti-aliased files have one image per layer per level.
+	Progress func(done int, total int)
+}
+
+// Options for EncodeWithOptions. The zero value encodes exactly like EncodeTo.
+type EncodeOptions struct {
+	// Called after each layer image is written with how many have been written so far,
+	// out of total. Layers sharing their image data only count once.
+	Progress func(done int, total int)
+}
+
+// decodeLimits are the sanity limits decodeHeaders applies.
+type decodeLimits struct {
+	layers             uint32
+	screenDim          uint32
+	totalLayerDataSize uint64
+}
+
+var defaultDecodeLimits = decodeLimits{
+	layers:             maxLayers,
+	screenDim:          maxScreenDim,
+	totalLayerDataSize: maxTotalLayerDataSize,
+}
+
+// limits returns the default limits, overridden by any set in opts.
+func (opts *DecodeOptions) limits() decodeLimits {
+	limits := defaultDecodeLimits
+	if opts == nil {
+		return limits
+	}
+
+	if opts.MaxLayers != 0 {
+		limits.layers = opts.MaxLayers
+	}
+	if opts.MaxScreenSize != 0 {
+		limits.screenDim = opts.MaxScreenSize
+	}
+	if opts.MaxTotalBytes != 0 {
+		limits.totalLayerDataSize = opts.MaxTotalBytes
+	}
+	return limits
+}
+
+// progress calls the Progress callback, if there is one.
+func (opts *DecodeOptions) progress(done int, total int) {
+	if opts != nil && opts.Progress != nil {
+		opts.Progress(done, total)
+	}
+}
+
+// progress calls the Progress callback, if there is one.
+func (opts *EncodeOptions) progress(done int, total int) {
+	if opts != nil && opts.Progress != nil {
+		opts.Progress(done, total)
+	}
+}
+
+// Decodes a file like Decode, with the given limits and progress reporting.
+// ctx is checked between layers; once it is done decoding stops and ctx.Err() is returned.
+// opts may be nil.
+func DecodeWithOptions(ctx context.Context, rdr io.ReadSeeker, opts *DecodeOptions) (*PhotonFile, error) {
+	return decode(ctx, rdr, opts, true, true, nil)
+}
+
+// Encodes the file like EncodeTo, with progress reporting.
+// ctx is checked between layers; once it is done encoding stops and ctx.Err() is returned,
+// leaving a partial file in writer. opts may be nil.
+func (pf *PhotonFile) EncodeWithOptions(ctx context.Context, writer io.Writer, opts *EncodeOptions) error {
+	return pf.encode(ctx, writer, opts)
+}
@@ -0,0 +1,120 @@
+package photon
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestDecodeLimits(t *testing.T) {
+	data := encodeTest(t, testFile(t, Version1, 0))
+
+	tests := []struct {
+		name string
+		opts DecodeOptions
+		err  error
+	}{
+		{"defaults", DecodeOptions{}, nil},
+		{"enough layers", DecodeOptions{MaxLayers: 6}, nil},
+		{"too many layers", DecodeOptions{MaxLayers: 5}, ErrTooLarge},
+		{"enough screen", DecodeOptions{MaxScreenSize: 40}, nil},
+		{"screen too large", DecodeOptions{MaxScreenSize: 39}, ErrTooLarge},
+		{"too much layer data", DecodeOptions{MaxTotalBytes: 1}, ErrTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeWithOptions(context.Background(), bytes.NewReader(data), &tt.opts)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, expected %v", err, tt.err)
+			}
+			var formatErr *FormatError
+			if tt.err != nil && !errors.As(err, &formatErr) {
+				t.Errorf("got %#v, expected a *FormatError", err)
+			}
+		})
+	}
+}
+
+func TestDecodeProgress(t *testing.T) {
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pf := tc.pf(t)
+			data := encodeTest(t, pf)
+			total := len(pf.Layers) * pf.antiAliasLevels(pf.Version)
+
+			var calls []int
+			opts := &DecodeOptions{Progress: func(done int, n int) {
+				if n != total {
+					t.Errorf("progress total is %d, expected %d", n, total)
+				}
+				calls = append(calls, done)
+			}}
+			_, err := DecodeWithOptions(context.Background(), bytes.NewReader(data), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(calls) != total+1 {
+				t.Fatalf("progress called %d times, expected %d", len(calls), total+1)
+			}
+			for idx, done := range calls {
+				if done != idx {
+					t.Errorf("progress call %d reported %d done", idx, done)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeCancel(t *testing.T) {
+	data := encodeTest(t, testFile(t, Version1, 0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var last int
+	opts := &DecodeOptions{Progress: func(done int, total int) {
+		last = done
+		if done == 2 {
+			cancel()
+		}
+	}}
+	pf, err := DecodeWithOptions(ctx, bytes.NewReader(data), opts)
+	if err != context.Canceled {
+		t.Fatalf("got %v, expected context.Canceled", err)
+	}
+	if pf != nil || last != 2 {
+		t.Errorf("kept decoding after being cancelled, got to layer %d", last)
+	}
+}
+
+func TestEncodeProgress(t *testing.T) {
+	pf := testFile(t, Version1, 0)
+
+	// Layers 4 and 5 share their image data.
+	var calls []int
+	opts := &EncodeOptions{Progress: func(done int, total int) {
+		if total != 5 {
+			t.Errorf("progress total is %d, expected 5", total)
+		}
+		calls = append(calls, done)
+	}}
+	var buf bytes.Buffer
+	err := pf.EncodeWithOptions(context.Background(), &buf, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), encodeTest(t, pf)) {
+		t.Error("encoded file differs from EncodeTo")
+	}
+	if len(calls) != 5 || calls[0] != 1 || calls[4] != 5 {
+		t.Errorf("progress reported %v", calls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = pf.EncodeWithOptions(ctx, &buf, nil)
+	if err != context.Canceled {
+		t.Errorf("encoding with a cancelled context gave %v", err)
+	}
+}
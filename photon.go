@@ -1,12 +1,41 @@
 package photon
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/binary"
+	"fmt"
 	"image"
 	"io"
+	"strings"
+)
+
+// File format versions understood by Decode and EncodeTo.
+const (
+	Version1 = 1
+	Version2 = 2 // Adds the print parameters block.
+)
+
+const (
+	headerMagic = 0x12FD0019
+
+	layerOffsetRelative = 0x80000000 // Seek type bit of binCompatLayerHeader.ImageDataOffset
+	layerOffsetMask     = 0x7FFFFFFF
+)
+
+// Sanity limits applied while decoding, so that a corrupt or hostile file
+// can't make us allocate unreasonable amounts of memory. DecodeOptions can override some of them.
+const (
+	maxLayers             = 100000
+	maxScreenDim          = 16384
+	maxPreviewDim         = 4096
+	maxAntiAliasLevel     = 16
+	maxTotalLayerDataSize = 1 << 31
 )
 
 type PhotonFile struct {
+	Version            uint32 // Version1 or Version2. Zero is treated as Version1 when encoding.
 	PlateX             float32
 	PlateY             float32
 	PlateZ             float32
@@ -17,12 +46,42 @@ type PhotonFile struct {
 	BottomLayers       uint32
 	ScreenHeight       uint32
 	ScreenWidth        uint32
-	LightCuringType    uint32 // ProjectionType
+	LightCuringType    LightCuringType // ProjectionType, see Projection.
 
+	// Only stored in Version2 files. Decode fills in defaults for files
+	// without print parameters, as New does.
+	PrintParameters  PrintParameters
+	MachineName      string // Shown by the printer, and checked by some firmware.
+	MachineInfoExtra MachineInfoExtra
+	AntiAliasLevel   uint32 // Number of anti-aliasing levels stored per layer, 0 or 1 means none.
+
+	// The machine name as read by Decode, including any NUL padding. EncodeTo writes
+	// it back verbatim as long as MachineName hasn't been changed.
+	MachineNameRawData []byte
+
+	// Set if the layer headers locate their image data relative to the end
+	// of each header rather than from the start of the file.
+	RelativeLayerOffsets bool
+
+	// If nil, EncodeTo writes a blank black image of DefaultPreviewSize / DefaultThumbnailSize.
 	PreviewImage   *image.RGBA
 	ThumbnailImage *image.RGBA
 
+	// The encoded preview and thumbnail data as read by Decode. EncodeTo writes these back
+	// verbatim, instead of re-encoding the images, as long as the images haven't been changed.
+	PreviewRawData   []byte
+	ThumbnailRawData []byte
+
 	Layers []Layer
+
+	// How EncodeTo arranges the file. Decode fills this in with the layout of the file
+	// it read, so that it can be reproduced. If nil, DefaultLayout is used.
+	Layout *Layout
+
+	// Header fields we don't understand yet, kept so they can be written back unchanged.
+	HeaderExtra    FileHeaderExtra
+	PreviewExtra   PreviewHeaderExtra
+	ThumbnailExtra PreviewHeaderExtra
 }
 
 type Layer struct {
@@ -30,11 +89,44 @@ type Layer struct {
 	AbsoluteHeight  float32
 	ExposureTime    float32
 	PerLayerOffTime float32
+
+	// Image data for the remaining anti-aliasing levels, in order, when the
+	// file has an AntiAliasLevel above 1. RawData holds the first level.
+	AntiAliasRawData [][]byte
+
+	// Layer header fields we don't understand yet, kept so they can be written back unchanged.
+	Extra LayerHeaderExtra
+}
+
+// Raw values of the unknown binCompatFileHeader fields, named by their offset.
+type FileHeaderExtra struct {
+	Field_14 uint32
+	Field_18 uint32
+	Field_1C uint32
+	Field_4C uint32
+	Field_54 uint32 // Version 1 only, holds the print parameters offset in version 2.
+	Field_58 uint32 // Version 1 only, holds the print parameters size in version 2.
+	Field_5C uint32 // Version 1 only, holds the anti-aliasing level in version 2.
+	Field_60 uint32
+	Field_64 uint32
+	Field_68 uint32 // Version 1 only, holds the machine info offset in version 2.
+}
+
+// Raw values of the unknown binCompatPreviewHeader fields, named by their offset.
+type PreviewHeaderExtra struct {
+	Field_10 uint64
+	Field_18 uint64
+}
+
+// Raw values of the unknown binCompatLayerHeader fields, named by their offset.
+type LayerHeaderExtra struct {
+	Field_14 uint64
+	Field_1C uint64
 }
 
 type binCompatFileHeader struct {
 	Magic1                       uint32 // Always 0x12FD0019
-	Magic2                       uint32 // Always 0x01
+	Magic2                       uint32 // Version, 0x01 or 0x02
 	PlateX                       float32
 	PlateY                       float32
 	PlateZ                       float32
@@ -54,12 +146,12 @@ type binCompatFileHeader struct {
 	PreviewThumbnailHeaderOffset uint32
 	Field_4C                     uint32
 	LightCuringType              uint32 // ProjectionType
-	Field_54                     uint32
-	Field_58                     uint32
+	PrintParametersOffset        uint32 // Version 2 only
+	PrintParametersSize          uint32 // Version 2 only
+	AntiAliasLevel               uint32 // Version 2 only
 	Field_60                     uint32
-	Field_5C                     uint32
 	Field_64                     uint32
-	Field_68                     uint32
+	MachineInfoOffset            uint32 // Version 2 only
 }
 
 type binCompatPreviewHeader struct {
@@ -79,84 +171,316 @@ type binCompatLayerHeader struct {
 	// Most significant bit is seek type
 	// switch(ImageDataOffset>>31)
 	//		case 0: from start of file (Only seen this one actually being used.)
-	//		case 1: relative (probably...)
+	//		case 1: relative (probably...) to the end of this layer header.
 	ImageDataOffset uint32
 	ImageDataSize   uint32
 	Field_14        uint64 // Unused, always 0
 	Field_1C        uint64 // Unused, always 0
 }
 
-func Decode(rdr io.ReadSeeker) (*PhotonFile, error) {
-	// Read main file header
-	var header binCompatFileHeader
-	err := binary.Read(rdr, binary.LittleEndian, &header)
-	if err != nil {
-		return nil, err
+// dataOffset returns the absolute file offset of the layer's image data,
+// given the offset at which the layer header itself ends.
+func (lh binCompatLayerHeader) dataOffset(headerEnd int64) int64 {
+	offset := int64(lh.ImageDataOffset & layerOffsetMask)
+	if lh.ImageDataOffset&layerOffsetRelative != 0 {
+		offset += headerEnd
 	}
+	return offset
+}
 
-	// Read layers
-	rdr.Seek(int64(header.LayerHeadersOffset), io.SeekStart)
-	layerHeaders := make([]binCompatLayerHeader, header.TotalLayers)
+// layerDataSection names the section for the idx'th entry of the layer header tables.
+func layerDataSection(idx int, totalLayers uint32) string {
+	if uint32(idx) < totalLayers {
+		return fmt.Sprintf("layer %d data", idx)
+	}
+	return fmt.Sprintf("layer %d level %d data", uint32(idx)%totalLayers, uint32(idx)/totalLayers)
+}
 
-	err = binary.Read(rdr, binary.LittleEndian, &layerHeaders)
+// Decodes a .photon / .cbddlp file from the given reader.
+// Malformed files are reported as a *FormatError wrapping the cause (e.g. ErrBadMagic).
+// Every offset and size is checked against the stream length and the decoder
+// limits before anything is allocated.
+// Readers that can't seek are read into memory first.
+func Decode(rdr io.Reader) (*PhotonFile, error) {
+	rs, err := readSeeker(rdr)
 	if err != nil {
 		return nil, err
 	}
+	return decode(context.Background(), rs, nil, true, true, nil)
+}
+
+// Decodes only the file header and layer header table, in the style of image.DecodeConfig.
+// The returned Layers have their heights and exposure times filled in, but no RawData.
+// The preview and thumbnail images are only decoded if withPreviews is set.
+func DecodeConfig(rdr io.ReadSeeker, withPreviews bool) (*PhotonFile, error) {
+	return decode(context.Background(), rdr, nil, false, withPreviews, nil)
+}
 
-	// Read in the preview image data
-	var previewHeader binCompatPreviewHeader
-	rdr.Seek(int64(header.PreviewHeaderOffset), io.SeekStart)
-	err = binary.Read(rdr, binary.LittleEndian, &previewHeader)
+func decode(ctx context.Context, rdr io.ReadSeeker, opts *DecodeOptions, readLayerData bool, readPreviews bool, report *SalvageReport) (*PhotonFile, error) {
+	sr, err := newSectionReader(rdr)
 	if err != nil {
 		return nil, err
 	}
-	previewData := make([]uint16, previewHeader.PreviewDataSize/2)
-	rdr.Seek(int64(previewHeader.PreviewDataOffset), io.SeekStart)
-	err = binary.Read(rdr, binary.LittleEndian, &previewData)
+
+	pf, lt, err := decodeHeaders(sr, readPreviews, opts.limits(), report)
 	if err != nil {
 		return nil, err
 	}
-	previewImg := decodePreview(previewData, previewHeader.Height, previewHeader.Width)
 
-	// Read in the thumbnail image data
-	var thumbnailHeader binCompatPreviewHeader
-	rdr.Seek(int64(header.PreviewThumbnailHeaderOffset), io.SeekStart)
-	err = binary.Read(rdr, binary.LittleEndian, &thumbnailHeader)
+	if !readLayerData {
+		return pf, nil
+	}
+
+	// Layers pointing at the same data share a single copy of it.
+	spanData := make(map[layerDataSpan][]byte)
+	screenPixels := uint64(pf.ScreenWidth) * uint64(pf.ScreenHeight)
+	for idx := range lt.headers {
+		err = ctx.Err()
+		if err != nil {
+			return nil, err
+		}
+		opts.progress(idx, len(lt.headers))
+
+		if lt.broken[uint32(idx)%lt.totalLayers] {
+			continue
+		}
+
+		// Read in the image data
+		span := layerDataSpan{lt.dataOffsets[idx], lt.headers[idx].ImageDataSize}
+		imageData, ok := spanData[span]
+		if !ok {
+			imageData, err = sr.readLayerData(lt, idx)
+			if err == nil && report != nil && layerImageDataPixels(imageData) != screenPixels {
+				// Damaged image data usually no longer covers the screen exactly.
+				err = &FormatError{Section: layerDataSection(idx, lt.totalLayers), Offset: lt.dataOffsets[idx], Err: ErrBadImageData}
+			}
+			if err != nil {
+				if report.salvage(err) != nil {
+					return nil, err
+				}
+				lt.broken[uint32(idx)%lt.totalLayers] = true
+				continue
+			}
+			spanData[span] = imageData
+		}
+
+		// Any headers past the first table belong to the higher anti-aliasing levels.
+		l := &pf.Layers[uint32(idx)%lt.totalLayers]
+		if uint32(idx) < lt.totalLayers {
+			l.RawData = imageData
+		} else {
+			l.AntiAliasRawData = append(l.AntiAliasRawData, imageData)
+		}
+	}
+
+	opts.progress(len(lt.headers), len(lt.headers))
+
+	if report != nil {
+		pf.Layers = report.dropBrokenLayers(pf.Layers, lt.broken)
+	}
+
+	// Only share identical layer data when re-encoding if the file did.
+	if pf.Layout != nil && hasDuplicateLayerData(pf) {
+		pf.Layout.DeduplicateLayerData = false
+	}
+
+	return pf, nil
+}
+
+// layerDataSpan identifies a block of layer image data within a file.
+type layerDataSpan struct {
+	offset int64
+	size   uint32
+}
+
+// layerTable holds the layer header tables of a file, along with where each entry's image data lives.
+type layerTable struct {
+	totalLayers uint32 // Layers per table, as given by the file header.
+	headers     []binCompatLayerHeader
+	dataOffsets []int64
+
+	// Layers that are missing headers or have unusable data. Only set when salvaging.
+	broken map[uint32]bool
+}
+
+// decodeHeaders reads and validates everything but the layer image data.
+// The returned layers have no RawData.
+// If report is non-nil, problems with anything but the main header are noted in it
+// and decoding carries on with whatever could be read.
+func decodeHeaders(sr *sectionReader, readPreviews bool, limits decodeLimits, report *SalvageReport) (*PhotonFile, *layerTable, error) {
+	// Read main file header
+	var header binCompatFileHeader
+	err := sr.read("header", 0, &header)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	if header.Magic1 != headerMagic {
+		return nil, nil, &FormatError{Section: "header", Offset: 0, Err: ErrBadMagic}
+	}
+	if header.Magic2 != Version1 && header.Magic2 != Version2 {
+		return nil, nil, &FormatError{Section: "header", Offset: 4, Err: ErrUnsupportedVersion}
+	}
+	if header.ScreenHeight > limits.screenDim {
+		return nil, nil, &FormatError{Section: "header", Offset: 0x34, Err: ErrTooLarge}
+	}
+	if header.ScreenWidth > limits.screenDim {
+		return nil, nil, &FormatError{Section: "header", Offset: 0x38, Err: ErrTooLarge}
+	}
+
+	// Read layers, anti-aliased files store one full table of layer headers per level.
+	levels := uint32(1)
+	if header.Magic2 >= Version2 && header.AntiAliasLevel > 1 {
+		levels = header.AntiAliasLevel
 	}
-	thumbnailData := make([]uint16, thumbnailHeader.PreviewDataSize/2)
-	rdr.Seek(int64(thumbnailHeader.PreviewDataOffset), io.SeekStart)
-	err = binary.Read(rdr, binary.LittleEndian, &thumbnailData)
+	if header.TotalLayers > limits.layers {
+		return nil, nil, &FormatError{Section: "header", Offset: 0x44, Err: ErrTooLarge}
+	}
+	if levels > maxAntiAliasLevel {
+		return nil, nil, &FormatError{Section: "header", Offset: 0x5C, Err: ErrTooLarge}
+	}
+	layerHeaderSize := uint64(binary.Size(binCompatLayerHeader{}))
+	totalLayerHeaders := uint64(header.TotalLayers) * uint64(levels)
+	err = sr.check("layer headers", int64(header.LayerHeadersOffset), totalLayerHeaders*layerHeaderSize)
 	if err != nil {
-		return nil, err
+		if report.salvage(err) != nil {
+			return nil, nil, err
+		}
+
+		// Only keep the layer headers that are actually in the file.
+		totalLayerHeaders = 0
+		if int64(header.LayerHeadersOffset) < sr.size {
+			totalLayerHeaders = uint64(sr.size-int64(header.LayerHeadersOffset)) / layerHeaderSize
+		}
+	}
+	layerHeaders := make([]binCompatLayerHeader, totalLayerHeaders)
+	if totalLayerHeaders > 0 {
+		err = sr.read("layer headers", int64(header.LayerHeadersOffset), &layerHeaders)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
-	thumbnailImg := decodePreview(thumbnailData, thumbnailHeader.Height, thumbnailHeader.Width)
 
-	var layers []Layer
-	for _, layer := range layerHeaders {
-		// Read in the image data
-		imageData := make([]byte, layer.ImageDataSize)
+	var previewImg, thumbnailImg *image.RGBA
+	var previewData, thumbnailData []byte
+	var previewHeader, thumbnailHeader binCompatPreviewHeader
+	if readPreviews {
+		// Read in the preview image data
+		previewImg, previewData, previewHeader, err = sr.readPreview("preview", int64(header.PreviewHeaderOffset))
+		if report.salvage(err) != nil {
+			return nil, nil, err
+		}
+
+		// Read in the thumbnail image data
+		thumbnailImg, thumbnailData, thumbnailHeader, err = sr.readPreview("thumbnail", int64(header.PreviewThumbnailHeaderOffset))
+		if report.salvage(err) != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Read in the print parameters
+	var printParams binCompatPrintParameters
+	hasPrintParams := header.Magic2 >= Version2 && header.PrintParametersOffset != 0
+	if hasPrintParams {
+		err = sr.read("print parameters", int64(header.PrintParametersOffset), &printParams)
+		if report.salvage(err) != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Read in the machine info and name
+	var machineInfo binCompatMachineInfo
+	var machineName string
+	var machineNameData []byte
+	if header.Magic2 >= Version2 && header.MachineInfoOffset != 0 {
+		machineName, machineNameData, err = sr.readMachineInfo(int64(header.MachineInfoOffset), &machineInfo)
+		if report.salvage(err) != nil {
+			return nil, nil, err
+		}
+	}
 
-		rdr.Seek(int64(layer.ImageDataOffset), io.SeekStart)
-		err = binary.Read(rdr, binary.LittleEndian, &imageData)
+	// Layers we only have some of the anti-aliasing level headers for can't be used.
+	totalLayers := header.TotalLayers
+	var broken map[uint32]bool
+	if report != nil {
+		broken = make(map[uint32]bool)
+		if uint64(len(layerHeaders)) < uint64(totalLayers) {
+			totalLayers = uint32(len(layerHeaders))
+		}
+		for idx := uint64(len(layerHeaders)); idx < uint64(header.TotalLayers)*uint64(levels); idx++ {
+			if layerIdx := uint32(idx % uint64(header.TotalLayers)); layerIdx < totalLayers {
+				broken[layerIdx] = true
+			}
+		}
+	}
+
+	// Validate all of the layer data spans up front, so we don't allocate
+	// anything for a file that will fail part way through.
+	maxLayerDataSize := uint64(header.ScreenWidth) * uint64(header.ScreenHeight)
+	totalLayerDataSize := uint64(0)
+
+	// Distinct spans that don't overlap can't add up to more than the file holds, so
+	// anything more means spans partly overlapping each other to read the same bytes
+	// over and over.
+	maxTotalLayerDataSize := limits.totalLayerDataSize
+	if uint64(sr.size) < maxTotalLayerDataSize {
+		maxTotalLayerDataSize = uint64(sr.size)
+	}
+	seenSpans := make(map[layerDataSpan]bool)
+	relativeOffsets := false
+	layerDataOffsets := make([]int64, len(layerHeaders))
+	for idx, layer := range layerHeaders {
+		headerEnd := int64(header.LayerHeadersOffset) + int64(idx+1)*int64(binary.Size(binCompatLayerHeader{}))
+		layerDataOffsets[idx] = layer.dataOffset(headerEnd)
+		if layer.ImageDataOffset&layerOffsetRelative != 0 {
+			relativeOffsets = true
+		}
+
+		section := layerDataSection(idx, header.TotalLayers)
+		err = sr.check(section, layerDataOffsets[idx], uint64(layer.ImageDataSize))
+		if uint64(layer.ImageDataSize) > maxLayerDataSize {
+			err = &FormatError{Section: section, Offset: layerDataOffsets[idx], Err: ErrTooLarge}
+		}
 		if err != nil {
-			return nil, err
+			if report.salvage(err) != nil {
+				return nil, nil, err
+			}
+			broken[uint32(idx)%header.TotalLayers] = true
+			continue
 		}
 
-		// Deocode image data
-		//img := decodeLayerImageData(imageData, header.ScreenHeight, header.ScreenWidth)
+		// Layers sharing the same data are only read once, so only count it once.
+		span := layerDataSpan{layerDataOffsets[idx], layer.ImageDataSize}
+		if seenSpans[span] {
+			continue
+		}
+		seenSpans[span] = true
+
+		totalLayerDataSize += uint64(layer.ImageDataSize)
+		if totalLayerDataSize > maxTotalLayerDataSize {
+			err = &FormatError{Section: section, Offset: layerDataOffsets[idx], Err: ErrTooLarge}
+			if report.salvage(err) != nil {
+				return nil, nil, err
+			}
+			broken[uint32(idx)%header.TotalLayers] = true
+		}
+	}
 
+	var layers []Layer
+	for _, layer := range layerHeaders[:totalLayers] {
 		layers = append(layers, Layer{
-			//Image:           img,
-			RawData:         imageData,
 			AbsoluteHeight:  layer.AbsoluteHeight,
 			ExposureTime:    layer.ExposureTime,
 			PerLayerOffTime: layer.PerLayerOffTime,
+			Extra: LayerHeaderExtra{
+				Field_14: layer.Field_14,
+				Field_1C: layer.Field_1C,
+			},
 		})
 	}
 
-	return &PhotonFile{
+	pf := &PhotonFile{
+		Version:            header.Magic2,
 		PlateX:             header.PlateX,
 		PlateY:             header.PlateY,
 		PlateZ:             header.PlateZ,
@@ -167,14 +491,108 @@ func Decode(rdr io.ReadSeeker) (*PhotonFile, error) {
 		BottomLayers:       header.BottomLayers,
 		ScreenHeight:       header.ScreenHeight,
 		ScreenWidth:        header.ScreenWidth,
-		LightCuringType:    header.LightCuringType,
-		PreviewImage:       previewImg,
-		ThumbnailImage:     thumbnailImg,
-		Layers:             layers,
-	}, nil
+		LightCuringType:    LightCuringType(header.LightCuringType),
+		PrintParameters:    printParams.toPrintParameters(),
+		MachineName:        machineName,
+		MachineInfoExtra:   machineInfo.extra(),
+		AntiAliasLevel:     header.AntiAliasLevel,
+		MachineNameRawData: machineNameData,
+
+		RelativeLayerOffsets: relativeOffsets,
+
+		PreviewImage:     previewImg,
+		ThumbnailImage:   thumbnailImg,
+		PreviewRawData:   previewData,
+		ThumbnailRawData: thumbnailData,
+		Layers:           layers,
+
+		HeaderExtra: FileHeaderExtra{
+			Field_14: header.Field_14,
+			Field_18: header.Field_18,
+			Field_1C: header.Field_1C,
+			Field_4C: header.Field_4C,
+			Field_60: header.Field_60,
+			Field_64: header.Field_64,
+		},
+		PreviewExtra: PreviewHeaderExtra{
+			Field_10: previewHeader.Field_10,
+			Field_18: previewHeader.Field_18,
+		},
+		ThumbnailExtra: PreviewHeaderExtra{
+			Field_10: thumbnailHeader.Field_10,
+			Field_18: thumbnailHeader.Field_18,
+		},
+	}
+
+	if header.Magic2 == Version1 {
+		pf.HeaderExtra.Field_54 = header.PrintParametersOffset
+		pf.HeaderExtra.Field_58 = header.PrintParametersSize
+		pf.HeaderExtra.Field_5C = header.AntiAliasLevel
+		pf.HeaderExtra.Field_68 = header.MachineInfoOffset
+		pf.AntiAliasLevel = 0
+	}
+
+	// Files without print parameters get the ones New would give them,
+	// so that upgrading them to Version2 doesn't write zeroes.
+	if !hasPrintParams {
+		pf.PrintParameters = pf.printParametersWithDefaults(PrintParameters{})
+	}
+
+	lt := &layerTable{
+		totalLayers: header.TotalLayers,
+		headers:     layerHeaders,
+		dataOffsets: layerDataOffsets,
+		broken:      broken,
+	}
+	if report != nil {
+		report.TotalLayers = header.TotalLayers
+	}
+
+	// Record where everything was, so that re-encoding can put it back in the same place.
+	// Damaged files just get the default layout.
+	if readPreviews && report == nil {
+		spans := []sectionSpan{
+			{SectionPreviewHeader, int64(header.PreviewHeaderOffset), int64(binary.Size(previewHeader))},
+			{SectionPreviewData, int64(previewHeader.PreviewDataOffset), int64(previewHeader.PreviewDataSize)},
+			{SectionThumbnailHeader, int64(header.PreviewThumbnailHeaderOffset), int64(binary.Size(thumbnailHeader))},
+			{SectionThumbnailData, int64(thumbnailHeader.PreviewDataOffset), int64(thumbnailHeader.PreviewDataSize)},
+			{SectionLayerHeaders, int64(header.LayerHeadersOffset), int64(len(layerHeaders)) * int64(layerHeaderSize)},
+		}
+		if hasPrintParams {
+			spans = append(spans, sectionSpan{SectionPrintParameters, int64(header.PrintParametersOffset), int64(binary.Size(printParams))})
+		}
+		if header.Magic2 >= Version2 && header.MachineInfoOffset != 0 {
+			spans = append(spans,
+				sectionSpan{SectionMachineInfo, int64(header.MachineInfoOffset), int64(binary.Size(machineInfo))},
+				sectionSpan{SectionMachineName, int64(machineInfo.MachineNameOffset), int64(machineInfo.MachineNameSize)},
+			)
+		}
+
+		if dataSpan, ok := detectLayerDataLayout(lt); ok {
+			if dataSpan.size > 0 {
+				spans = append(spans, dataSpan)
+			}
+			pf.Layout = detectLayout(sr, int64(binary.Size(header)), spans)
+		}
+		if pf.Layout != nil {
+			// Leaving the print parameters out of the layout keeps them out of the re-encoded file.
+			if header.Magic2 >= Version2 && !hasPrintParams {
+				idx := pf.Layout.index(SectionPrintParameters)
+				pf.Layout.Sections = append(pf.Layout.Sections[:idx], pf.Layout.Sections[idx+1:]...)
+			}
+			pf.Layout.DeduplicateLayerData = true
+			pf.Layout.HeaderExtra = pf.HeaderExtra
+			pf.Layout.PreviewExtra = pf.PreviewExtra
+			pf.Layout.ThumbnailExtra = pf.ThumbnailExtra
+		}
+	}
+
+	return pf, lt, nil
 }
 
 /*
+DefaultLayout, decoded files may order their sections differently and have padding in between:
+
 header
 
 previewHeader
@@ -182,77 +600,154 @@ previewData
 thumbnailHeader
 thumbnailData
 
+printParameters (version 2 only)
+machineInfo (version 2 only, optional)
+machineName
+
 layer0Header
 layer1Header
 layer2Header
 ...
 layer9Header
+(repeated for each anti-aliasing level)
 
 layer0Data
 layer1Data
 layer2Data
 ...
 layer9Data
+(repeated for each anti-aliasing level, identical data is only written once)
 */
 
-// Encodes the data in .photon / .cbddlp file format to the given writer.
-func (pf *PhotonFile) EncodeTo(writer io.Writer) error {
+// encodeVersion returns the file format version EncodeTo should write.
+func (pf *PhotonFile) encodeVersion() (uint32, error) {
+	version := pf.Version
+	if version == 0 {
+		version = Version1
+	}
+	if version != Version1 && version != Version2 {
+		return 0, ErrUnsupportedVersion
+	}
+	return version, nil
+}
 
-	err := error(nil)
-	previewData := U16ToU8Slice(encodePreview(pf.PreviewImage))
-	thumbnailData := U16ToU8Slice(encodePreview(pf.ThumbnailImage))
+// antiAliasLevels returns the number of layer header tables to write.
+func (pf *PhotonFile) antiAliasLevels(version uint32) int {
+	if version >= Version2 && pf.AntiAliasLevel > 1 {
+		return int(pf.AntiAliasLevel)
+	}
+	return 1
+}
 
-	/*
-		previewData, err := ioutil.ReadFile("saved_preview_835x321.bin")
-		if err != nil {
-			return err
-		}
+// header builds the layer header pointing at the given image data.
+func (l Layer) header(imageDataOffset uint32, imageDataSize uint32) binCompatLayerHeader {
+	return binCompatLayerHeader{
+		AbsoluteHeight:  l.AbsoluteHeight,
+		ExposureTime:    l.ExposureTime,
+		PerLayerOffTime: l.PerLayerOffTime,
+		ImageDataOffset: imageDataOffset,
+		ImageDataSize:   imageDataSize,
+		Field_14:        l.Extra.Field_14,
+		Field_1C:        l.Extra.Field_1C,
+	}
+}
 
-		thumbnailData, err := ioutil.ReadFile("saved_thumbnail_199x72.bin")
-		if err != nil {
-			return err
-		}
-	*/
+// fileSections holds the encoded sections of a file, and where the layout puts each of them.
+type fileSections struct {
+	header binCompatFileHeader
+	layout *Layout
 
-	var layerDatas [][]byte
-	for i := 0; i < len(pf.Layers); i++ {
-		layerDatas = append(layerDatas, pf.Layers[i].RawData)
+	sizes    [numSections]int64  // -1 for sections the file doesn't have.
+	offsets  [numSections]int64  // Where each section starts.
+	contents [numSections][]byte // Encoded sections, except the layer headers and data which the caller writes.
+
+	size int64 // End of the last section, not including the trailer.
+}
+
+// layout returns the Layout EncodeTo should use.
+func (pf *PhotonFile) layout() (*Layout, error) {
+	if pf.Layout == nil {
+		return &DefaultLayout, nil
 	}
 
-	// Pre-calculate offsets so that we don't have to fixup the offset fields later.
-	pos := 0
-	pos += binary.Size(binCompatFileHeader{})
+	err := pf.Layout.check()
+	if err != nil {
+		return nil, err
+	}
+	return pf.Layout, nil
+}
 
-	// Preview offsets
-	previewHeaderOffset := pos
-	pos += binary.Size(binCompatPreviewHeader{})
-	previewDataOffset := pos
-	pos += len(previewData)
+// buildSections encodes every section but the layer headers and data, and lays them all out.
+// Pass -1 for the layer sizes to leave those sections out.
+// The header's TotalLayers is left for the caller to fill in.
+func (pf *PhotonFile) buildSections(version uint32, layout *Layout, layerHeadersSize int64, layerDataSize int64) *fileSections {
+	fs := &fileSections{layout: layout}
 
-	// Thumbnail offsets
-	thumbnailHeaderOffset := pos
-	pos += binary.Size(binCompatPreviewHeader{})
-	thumbnailDataOffset := pos
-	pos += len(thumbnailData)
+	previewImage := pf.PreviewImage
+	if previewImage == nil {
+		previewImage = blankPreview(DefaultPreviewSize)
+	}
 
-	// Layer headers offsets
-	var layerHeaderOffsets []int
-	for i := 0; i < len(pf.Layers); i++ {
-		layerHeaderOffsets = append(layerHeaderOffsets, pos)
-		pos += binary.Size(binCompatLayerHeader{})
+	thumbnailImage := pf.ThumbnailImage
+	if thumbnailImage == nil {
+		thumbnailImage = blankPreview(DefaultThumbnailSize)
 	}
 
-	// Layer data offsets
-	var layerDataOffsets []int
-	for i := 0; i < len(pf.Layers); i++ {
-		layerDataOffsets = append(layerDataOffsets, pos)
-		pos += len(layerDatas[i])
+	previewData := previewImageData(previewImage, pf.PreviewRawData)
+	thumbnailData := previewImageData(thumbnailImage, pf.ThumbnailRawData)
+
+	// Missing extras are taken from the layout, so files built from scratch can match a slicer's output.
+	headerExtra := pf.HeaderExtra
+	if headerExtra == (FileHeaderExtra{}) {
+		headerExtra = layout.HeaderExtra
+	}
+	previewExtra := pf.PreviewExtra
+	if previewExtra == (PreviewHeaderExtra{}) {
+		previewExtra = layout.PreviewExtra
+	}
+	thumbnailExtra := pf.ThumbnailExtra
+	if thumbnailExtra == (PreviewHeaderExtra{}) {
+		thumbnailExtra = layout.ThumbnailExtra
 	}
 
-	// Start forming and writing the file from here
-	header := binCompatFileHeader{
-		Magic1:                       0x12FD0019,
-		Magic2:                       0x01,
+	// Work out which sections there are and how big they are, then place them
+	// in layout order so that we don't have to fixup the offset fields later.
+	for s := range fs.sizes {
+		fs.sizes[s] = -1
+	}
+	fs.sizes[SectionPreviewHeader] = int64(binary.Size(binCompatPreviewHeader{}))
+	fs.sizes[SectionPreviewData] = int64(len(previewData))
+	fs.sizes[SectionThumbnailHeader] = int64(binary.Size(binCompatPreviewHeader{}))
+	fs.sizes[SectionThumbnailData] = int64(len(thumbnailData))
+	if version >= Version2 && layout.index(SectionPrintParameters) >= 0 {
+		fs.sizes[SectionPrintParameters] = int64(binary.Size(binCompatPrintParameters{}))
+	}
+	machineNameData := []byte(pf.MachineName)
+	if strings.TrimRight(string(pf.MachineNameRawData), "\x00") == pf.MachineName {
+		machineNameData = pf.MachineNameRawData
+	}
+	hasMachineInfo := version >= Version2 && (len(machineNameData) > 0 || pf.MachineInfoExtra != MachineInfoExtra{})
+	if hasMachineInfo {
+		fs.sizes[SectionMachineInfo] = int64(binary.Size(binCompatMachineInfo{}))
+		fs.sizes[SectionMachineName] = int64(len(machineNameData))
+	}
+	fs.sizes[SectionLayerHeaders] = layerHeadersSize
+	fs.sizes[SectionLayerData] = layerDataSize
+
+	pos := int64(binary.Size(binCompatFileHeader{}))
+	for _, ls := range layout.Sections {
+		if fs.sizes[ls.Section] < 0 {
+			continue
+		}
+		pos += int64(len(ls.Padding))
+		fs.offsets[ls.Section] = pos
+		pos += fs.sizes[ls.Section]
+	}
+	fs.size = pos
+
+	fs.header = binCompatFileHeader{
+		Magic1:                       headerMagic,
+		Magic2:                       version,
 		PlateX:                       pf.PlateX,
 		PlateY:                       pf.PlateY,
 		PlateZ:                       pf.PlateZ,
@@ -263,74 +758,220 @@ func (pf *PhotonFile) EncodeTo(writer io.Writer) error {
 		BottomLayers:                 pf.BottomLayers,
 		ScreenHeight:                 pf.ScreenHeight,
 		ScreenWidth:                  pf.ScreenWidth,
-		PreviewHeaderOffset:          uint32(previewHeaderOffset),
-		LayerHeadersOffset:           uint32(layerHeaderOffsets[0]),
-		TotalLayers:                  uint32(len(pf.Layers)),
-		PreviewThumbnailHeaderOffset: uint32(thumbnailHeaderOffset),
-		LightCuringType:              pf.LightCuringType,
+		PreviewHeaderOffset:          uint32(fs.offsets[SectionPreviewHeader]),
+		LayerHeadersOffset:           uint32(fs.offsets[SectionLayerHeaders]),
+		PreviewThumbnailHeaderOffset: uint32(fs.offsets[SectionThumbnailHeader]),
+		LightCuringType:              uint32(pf.LightCuringType),
+		Field_14:                     headerExtra.Field_14,
+		Field_18:                     headerExtra.Field_18,
+		Field_1C:                     headerExtra.Field_1C,
+		Field_4C:                     headerExtra.Field_4C,
+		PrintParametersOffset:        headerExtra.Field_54,
+		PrintParametersSize:          headerExtra.Field_58,
+		AntiAliasLevel:               headerExtra.Field_5C,
+		Field_60:                     headerExtra.Field_60,
+		Field_64:                     headerExtra.Field_64,
+		MachineInfoOffset:            headerExtra.Field_68,
 	}
 
 	previewHeader := binCompatPreviewHeader{
-		Width:/*835, // */ uint32(pf.PreviewImage.Bounds().Max.X),
-		Height:/*321, //*/ uint32(pf.PreviewImage.Bounds().Max.Y),
-		PreviewDataOffset: uint32(previewDataOffset),
+		Width:             uint32(previewImage.Bounds().Max.X),
+		Height:            uint32(previewImage.Bounds().Max.Y),
+		PreviewDataOffset: uint32(fs.offsets[SectionPreviewData]),
 		PreviewDataSize:   uint32(len(previewData)),
+		Field_10:          previewExtra.Field_10,
+		Field_18:          previewExtra.Field_18,
 	}
+	fs.contents[SectionPreviewHeader] = encodeSection(previewHeader)
+	fs.contents[SectionPreviewData] = previewData
 
 	thumbnailHeader := binCompatPreviewHeader{
-		Width:/*199, //*/ uint32(pf.ThumbnailImage.Bounds().Max.X),
-		Height:/*72,  //*/ uint32(pf.ThumbnailImage.Bounds().Max.Y),
-		PreviewDataOffset: uint32(thumbnailDataOffset),
+		Width:             uint32(thumbnailImage.Bounds().Max.X),
+		Height:            uint32(thumbnailImage.Bounds().Max.Y),
+		PreviewDataOffset: uint32(fs.offsets[SectionThumbnailData]),
 		PreviewDataSize:   uint32(len(thumbnailData)),
+		Field_10:          thumbnailExtra.Field_10,
+		Field_18:          thumbnailExtra.Field_18,
 	}
+	fs.contents[SectionThumbnailHeader] = encodeSection(thumbnailHeader)
+	fs.contents[SectionThumbnailData] = thumbnailData
 
-	var layerHeaders []binCompatLayerHeader
-	for idx, l := range pf.Layers {
-		layerHeaders = append(layerHeaders, binCompatLayerHeader{
-			AbsoluteHeight:  l.AbsoluteHeight,
-			ExposureTime:    l.ExposureTime,
-			PerLayerOffTime: l.PerLayerOffTime,
-			ImageDataOffset: uint32(layerDataOffsets[idx]),
-			ImageDataSize:   uint32(len(layerDatas[idx])),
-		})
+	if version >= Version2 {
+		if fs.sizes[SectionPrintParameters] >= 0 {
+			fs.contents[SectionPrintParameters] = encodeSection(pf.PrintParameters.toBinCompat())
+
+			fs.header.PrintParametersOffset = uint32(fs.offsets[SectionPrintParameters])
+			fs.header.PrintParametersSize = uint32(fs.sizes[SectionPrintParameters])
+		}
+		fs.header.MachineInfoOffset = 0
+		fs.header.AntiAliasLevel = pf.AntiAliasLevel
 	}
 
-	err = binary.Write(writer, binary.LittleEndian, header)
-	if err != nil {
-		return err
+	if hasMachineInfo {
+		machineInfo := pf.MachineInfoExtra.toBinCompat(uint32(fs.offsets[SectionMachineName]), uint32(len(machineNameData)))
+		fs.contents[SectionMachineInfo] = encodeSection(machineInfo)
+		fs.contents[SectionMachineName] = machineNameData
+
+		fs.header.MachineInfoOffset = uint32(fs.offsets[SectionMachineInfo])
 	}
 
-	err = binary.Write(writer, binary.LittleEndian, previewHeader)
+	return fs
+}
+
+// encodeSection encodes a fixed size binCompat struct.
+func encodeSection(data interface{}) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, data)
+	return buf.Bytes()
+}
+
+// writeTo writes the header and then every section the file has in layout order, each
+// preceded by its padding. writeLayer is called to write the layer headers and data.
+func (fs *fileSections) writeTo(writer io.Writer, writeLayer func(Section) error) error {
+	err := binary.Write(writer, binary.LittleEndian, fs.header)
 	if err != nil {
 		return err
 	}
 
-	err = binary.Write(writer, binary.LittleEndian, previewData)
-	if err != nil {
-		return err
+	for _, ls := range fs.layout.Sections {
+		if fs.sizes[ls.Section] < 0 {
+			continue
+		}
+
+		_, err = writer.Write(ls.Padding)
+		if err != nil {
+			return err
+		}
+
+		if ls.Section == SectionLayerHeaders || ls.Section == SectionLayerData {
+			err = writeLayer(ls.Section)
+		} else {
+			_, err = writer.Write(fs.contents[ls.Section])
+		}
+		if err != nil {
+			return err
+		}
 	}
 
-	err = binary.Write(writer, binary.LittleEndian, thumbnailHeader)
+	return nil
+}
+
+// Encodes the data in .photon / .cbddlp file format to the given writer.
+// Files with no layers are allowed, and missing previews are written as blank images.
+// The sections are arranged as described by pf.Layout.
+func (pf *PhotonFile) EncodeTo(writer io.Writer) error {
+	return pf.encode(context.Background(), writer, nil)
+}
+
+func (pf *PhotonFile) encode(ctx context.Context, writer io.Writer, opts *EncodeOptions) error {
+	version, err := pf.encodeVersion()
 	if err != nil {
 		return err
 	}
 
-	err = binary.Write(writer, binary.LittleEndian, thumbnailData)
+	layout, err := pf.layout()
 	if err != nil {
 		return err
 	}
 
-	err = binary.Write(writer, binary.LittleEndian, layerHeaders)
-	if err != nil {
-		return err
+	// Anti-aliased files store every layer once per level, level by level.
+	levels := pf.antiAliasLevels(version)
+
+	var layerDatas [][]byte
+	for level := 0; level < levels; level++ {
+		for i := 0; i < len(pf.Layers); i++ {
+			if level == 0 {
+				layerDatas = append(layerDatas, pf.Layers[i].RawData)
+				continue
+			}
+
+			if len(pf.Layers[i].AntiAliasRawData) != levels-1 {
+				return fmt.Errorf("photon: layer %d has %d anti-aliasing levels, expected %d", i, len(pf.Layers[i].AntiAliasRawData)+1, levels)
+			}
+			layerDatas = append(layerDatas, pf.Layers[i].AntiAliasRawData[level-1])
+		}
 	}
 
-	for _, s := range layerDatas {
-		err = binary.Write(writer, binary.LittleEndian, s)
-		if err != nil {
-			return err
+	// Identical layers (e.g. straight walls) all point at a single copy of the data. Without
+	// DeduplicateLayerData only layers that already share their data (as Decode leaves them) do.
+	var layerDataOffsets []int64
+	var uniqueLayerDatas [][]byte
+	layerDataSize := int64(0)
+	dataOffsets := make(map[interface{}]int64)
+	for i := 0; i < len(layerDatas); i++ {
+		var key interface{} = sha256.Sum256(layerDatas[i])
+		if !layout.DeduplicateLayerData {
+			key = sharedDataKey(layerDatas[i])
 		}
+
+		offset, ok := dataOffsets[key]
+		if !ok {
+			offset = layerDataSize
+			dataOffsets[key] = offset
+			uniqueLayerDatas = append(uniqueLayerDatas, layerDatas[i])
+			layerDataSize += int64(len(layerDatas[i]))
+		}
+		layerDataOffsets = append(layerDataOffsets, offset)
 	}
 
-	return nil
+	layerHeaderSize := int64(binary.Size(binCompatLayerHeader{}))
+	fs := pf.buildSections(version, layout, int64(len(layerDatas))*layerHeaderSize, layerDataSize)
+	fs.header.TotalLayers = uint32(len(pf.Layers))
+
+	var layerHeaders []binCompatLayerHeader
+	for idx := range layerDatas {
+		imageDataOffset := fs.offsets[SectionLayerData] + layerDataOffsets[idx]
+		if pf.RelativeLayerOffsets {
+			imageDataOffset -= fs.offsets[SectionLayerHeaders] + int64(idx+1)*layerHeaderSize
+		}
+		if imageDataOffset < 0 || imageDataOffset > layerOffsetMask {
+			return fmt.Errorf("photon: layer %d data offset 0x%X doesn't fit in a layer header", idx, imageDataOffset)
+		}
+
+		layerHeader := pf.Layers[idx%len(pf.Layers)].header(uint32(imageDataOffset), uint32(len(layerDatas[idx])))
+		if pf.RelativeLayerOffsets {
+			layerHeader.ImageDataOffset |= layerOffsetRelative
+		}
+		layerHeaders = append(layerHeaders, layerHeader)
+	}
+
+	err = fs.writeTo(writer, func(s Section) error {
+		if s == SectionLayerHeaders {
+			return binary.Write(writer, binary.LittleEndian, layerHeaders)
+		}
+
+		for i, data := range uniqueLayerDatas {
+			err := ctx.Err()
+			if err != nil {
+				return err
+			}
+
+			_, err = writer.Write(data)
+			if err != nil {
+				return err
+			}
+			opts.progress(i+1, len(uniqueLayerDatas))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.Write(layout.Trailer)
+	return err
+}
+
+// sharedData identifies a slice by the memory it refers to, rather than its contents.
+type sharedData struct {
+	first *byte
+	size  int
+}
+
+// sharedDataKey returns the sharedData key for the given slice, all empty slices share one key.
+func sharedDataKey(data []byte) sharedData {
+	if len(data) == 0 {
+		return sharedData{}
+	}
+	return sharedData{&data[0], len(data)}
 }
@@ -0,0 +1,263 @@
+package photon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"testing"
+	"time"
+)
+
+// testFile makes a small file with a few layers, two of which have the same image.
+func testFile(t *testing.T, version uint32, antiAliasLevel uint32) *PhotonFile {
+	pf := New(Profile{
+		Version:         version,
+		MachineName:     "Test Printer",
+		PlateX:          68,
+		PlateY:          120,
+		PlateZ:          150,
+		ScreenWidth:     40,
+		ScreenHeight:    30,
+		LightCuringType: LightCuringLCDMirror,
+		AntiAliasLevel:  antiAliasLevel,
+		PreviewSize:     image.Pt(32, 24),
+		ThumbnailSize:   image.Pt(16, 12),
+		BottomLayers:    2,
+	})
+
+	for y := 0; y < 24; y++ {
+		for x := 0; x < 32; x++ {
+			pf.PreviewImage.Set(x, y, color.RGBA{uint8(x * 8), uint8(y * 8), 0x80, 0xFF})
+		}
+	}
+
+	err := pf.InsertLayers(0, make([]Layer, 6)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for idx := range pf.Layers {
+		img := image.NewGray(image.Rect(0, 0, 40, 30))
+		for y := 0; y < 30; y++ {
+			for x := 0; x < 40; x++ {
+				// Layers 4 and 5 come out the same.
+				n := idx
+				if n == 5 {
+					n = 4
+				}
+				img.SetGray(x, y, color.Gray{uint8((x*7 + y*3 + n*11) % 256)})
+			}
+		}
+		err = pf.SetLayerImage(idx, img)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return pf
+}
+
+type testCase struct {
+	name string
+	pf   func(t *testing.T) *PhotonFile
+}
+
+var testCases = []testCase{
+	{"version 1", func(t *testing.T) *PhotonFile {
+		return testFile(t, Version1, 0)
+	}},
+	{"version 2", func(t *testing.T) *PhotonFile {
+		return testFile(t, Version2, 0)
+	}},
+	{"anti-aliased", func(t *testing.T) *PhotonFile {
+		return testFile(t, Version2, 4)
+	}},
+	{"relative offsets", func(t *testing.T) *PhotonFile {
+		pf := testFile(t, Version2, 2)
+		pf.RelativeLayerOffsets = true
+		return pf
+	}},
+	{"padded", func(t *testing.T) *PhotonFile {
+		pf := testFile(t, Version2, 2)
+		pf.MachineNameRawData = []byte("Test Printer\x00\x00\x00\x00")
+		pf.Layout = &Layout{
+			Sections: []LayoutSection{
+				{Section: SectionPreviewHeader, Padding: []byte{1, 2, 3, 4}},
+				{Section: SectionPreviewData},
+				{Section: SectionThumbnailHeader, Padding: []byte{0xFF}},
+				{Section: SectionThumbnailData},
+				{Section: SectionPrintParameters},
+				{Section: SectionMachineInfo, Padding: make([]byte, 12)},
+				{Section: SectionMachineName},
+				{Section: SectionLayerHeaders},
+				{Section: SectionLayerData, Padding: make([]byte, 3)},
+			},
+			Trailer:              []byte("trailer"),
+			DeduplicateLayerData: true,
+		}
+		return pf
+	}},
+}
+
+func encodeTest(t *testing.T, pf *PhotonFile) []byte {
+	var buf bytes.Buffer
+	err := pf.EncodeTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pf := tc.pf(t)
+			data := encodeTest(t, pf)
+
+			decoded, err := Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(decoded.Layers) != len(pf.Layers) {
+				t.Fatalf("decoded %d layers, expected %d", len(decoded.Layers), len(pf.Layers))
+			}
+			if decoded.RelativeLayerOffsets != pf.RelativeLayerOffsets {
+				t.Errorf("RelativeLayerOffsets is %v, expected %v", decoded.RelativeLayerOffsets, pf.RelativeLayerOffsets)
+			}
+			if pf.Version >= Version2 && decoded.MachineName != pf.MachineName {
+				t.Errorf("MachineName is %q, expected %q", decoded.MachineName, pf.MachineName)
+			}
+			if decoded.PreviewImage.Bounds() != pf.PreviewImage.Bounds() {
+				t.Errorf("preview image is %v, expected %v", decoded.PreviewImage.Bounds(), pf.PreviewImage.Bounds())
+			}
+			for idx := range pf.Layers {
+				want, err := pf.LayerImage(idx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := decoded.LayerImage(idx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got.Pix, want.Pix) {
+					t.Errorf("layer %d image changed", idx)
+				}
+			}
+
+			again := encodeTest(t, decoded)
+			if !bytes.Equal(again, data) {
+				t.Errorf("re-encoded file differs: %d bytes, expected %d", len(again), len(data))
+			}
+		})
+	}
+}
+
+// decodeDamaged runs the decoders over a damaged file, they may fail but mustn't panic or hang.
+func decodeDamaged(t *testing.T, what string, data []byte) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("%s: panic: %v", what, r)
+		}
+	}()
+
+	start := time.Now()
+	Decode(bytes.NewReader(data))
+	DecodeSalvage(bytes.NewReader(data))
+	Inspect(bytes.NewReader(data))
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("%s: took %v", what, elapsed)
+	}
+}
+
+func TestDecodeDamaged(t *testing.T) {
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data := encodeTest(t, tc.pf(t))
+
+			for size := 0; size < len(data); size++ {
+				decodeDamaged(t, fmt.Sprintf("truncated to %d bytes", size), data[:size])
+			}
+
+			damaged := make([]byte, len(data))
+			for idx := range data {
+				bit := uint(idx*3) % 8
+				copy(damaged, data)
+				damaged[idx] ^= 1 << bit
+				decodeDamaged(t, fmt.Sprintf("bit %d of byte 0x%X flipped", bit, idx), damaged)
+			}
+		})
+	}
+}
+
+func TestOverlappingLayerData(t *testing.T) {
+	data := encodeTest(t, testFile(t, Version1, 0))
+	layerHeadersOffset := binary.LittleEndian.Uint32(data[0x40:])
+
+	// Every layer reads most of the file, each starting a byte after the last.
+	size := uint32(len(data)) / 2
+	for idx := uint32(0); idx < 6; idx++ {
+		layerHeader := data[layerHeadersOffset+idx*36:]
+		binary.LittleEndian.PutUint32(layerHeader[0x0C:], idx)
+		binary.LittleEndian.PutUint32(layerHeader[0x10:], size)
+	}
+
+	_, err := Decode(bytes.NewReader(data))
+	if !errors.Is(err, ErrTooLarge) {
+		t.Errorf("decoding overlapping layer data gave %v, expected ErrTooLarge", err)
+	}
+}
+
+// highWaterReader records how far into the file anything was read.
+type highWaterReader struct {
+	*bytes.Reader
+	end int64
+}
+
+func (r *highWaterReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if pos := r.Reader.Size() - int64(r.Reader.Len()); pos > r.end {
+		r.end = pos
+	}
+	return n, err
+}
+
+func TestDecodeConfig(t *testing.T) {
+	pf := testFile(t, Version2, 0)
+	data := encodeTest(t, pf)
+	layerDataOffset := binary.LittleEndian.Uint32(data[binary.LittleEndian.Uint32(data[0x40:])+0x0C:])
+
+	for _, withPreviews := range []bool{false, true} {
+		rdr := &highWaterReader{Reader: bytes.NewReader(data)}
+		config, err := DecodeConfig(rdr, withPreviews)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rdr.end > int64(layerDataOffset) {
+			t.Errorf("read up to 0x%X, the layer data starts at 0x%X", rdr.end, layerDataOffset)
+		}
+
+		if config.MachineName != pf.MachineName || config.ScreenWidth != pf.ScreenWidth || config.ScreenHeight != pf.ScreenHeight {
+			t.Errorf("decoded header %q %dx%d", config.MachineName, config.ScreenWidth, config.ScreenHeight)
+		}
+		if len(config.Layers) != len(pf.Layers) {
+			t.Fatalf("decoded %d layers, expected %d", len(config.Layers), len(pf.Layers))
+		}
+		for idx, l := range config.Layers {
+			if l.RawData != nil {
+				t.Errorf("layer %d has image data", idx)
+			}
+			if l.AbsoluteHeight != pf.Layers[idx].AbsoluteHeight || l.ExposureTime != pf.Layers[idx].ExposureTime {
+				t.Errorf("layer %d is at %v for %vs, expected %v for %vs", idx, l.AbsoluteHeight, l.ExposureTime, pf.Layers[idx].AbsoluteHeight, pf.Layers[idx].ExposureTime)
+			}
+		}
+
+		if hasPreviews := config.PreviewImage != nil && config.ThumbnailImage != nil; hasPreviews != withPreviews {
+			t.Errorf("withPreviews %v decoded previews %v", withPreviews, hasPreviews)
+		} else if withPreviews && config.PreviewImage.Bounds() != pf.PreviewImage.Bounds() {
+			t.Errorf("preview image is %v, expected %v", config.PreviewImage.Bounds(), pf.PreviewImage.Bounds())
+		}
+	}
+}
@@ -1,11 +1,39 @@
 package photon
 
 import (
+	"bytes"
 	"image"
 	"image/color"
 	"image/draw"
 )
 
+// Sizes of the blank images EncodeTo writes when a PhotonFile has no preview or thumbnail.
+var (
+	DefaultPreviewSize   = image.Pt(400, 300)
+	DefaultThumbnailSize = image.Pt(200, 125)
+)
+
+// blankPreview creates an all black preview image of the given size.
+func blankPreview(size image.Point) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+	draw.Draw(img, img.Bounds(), &image.Uniform{PixelUnsetColor}, image.ZP, draw.Src)
+	return img
+}
+
+// previewImageData returns the encoded data for img. The original data is reused if it
+// still decodes to img, since re-encoding doesn't reproduce the slicer's choice of runs.
+func previewImageData(img *image.RGBA, original []byte) []byte {
+	bounds := img.Bounds()
+	if original != nil && bounds.Min == image.ZP {
+		decoded := decodePreview(U8ToU16Slice(original), uint32(bounds.Dy()), uint32(bounds.Dx()))
+		if decoded.Stride == img.Stride && bytes.Equal(decoded.Pix, img.Pix) {
+			return original
+		}
+	}
+
+	return U16ToU8Slice(encodePreview(img))
+}
+
 func decodePreview(data []uint16, imageHeight uint32, imageWidth uint32) *image.RGBA {
 	/*
 		Preview image can override filename text:
@@ -19,10 +47,14 @@ func decodePreview(data []uint16, imageHeight uint32, imageWidth uint32) *image.
 	img := image.NewRGBA(image.Rect(0, 0, int(imageWidth), int(imageHeight)))
 	//img := image.NewRGBA(image.Rect(0, 0, int(maxDim), int(maxDim)))
 	draw.Draw(img, img.Bounds(), &image.Uniform{PixelSetColor}, image.ZP, draw.Src)
+	if maxDim == 0 {
+		return img
+	}
 
-	// Left right, up to down
+	// Left right, up to down. Anything past the last pixel is ignored.
+	totalPixels := imageWidth * imageHeight
 	pixelIndex := uint32(0)
-	for i := 0; i < len(data); i++ {
+	for i := 0; i < len(data) && pixelIndex < totalPixels; i++ {
 		s := data[i]
 
 		// Split the uint16
@@ -42,6 +74,9 @@ func decodePreview(data []uint16, imageHeight uint32, imageWidth uint32) *image.
 
 			// Fill gap
 			targetPixelIndex := pixelIndex + uint32(fillCount)
+			if targetPixelIndex > totalPixels {
+				targetPixelIndex = totalPixels
+			}
 			for ; pixelIndex < targetPixelIndex; pixelIndex++ {
 				x := pixelIndex % maxDim
 				y := pixelIndex / maxDim
@@ -49,6 +84,9 @@ func decodePreview(data []uint16, imageHeight uint32, imageWidth uint32) *image.
 			}
 
 			i += 1
+			if pixelIndex >= totalPixels {
+				break
+			}
 		}
 
 		x := pixelIndex % maxDim
@@ -76,6 +114,9 @@ func encodePreview(img *image.RGBA) []uint16 {
 	*/
 	maxDim := imageWidth
 	maxPixelIndex := imageHeight * imageWidth
+	if maxPixelIndex == 0 {
+		return output
+	}
 
 	pixelAt := func(pi int) color.RGBA {
 		x := pi % maxDim
@@ -0,0 +1,54 @@
+package photon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"testing"
+	"time"
+)
+
+func TestHostilePreview(t *testing.T) {
+	data := encodeTest(t, testFile(t, Version1, 0))
+	previewHeaderOffset := binary.LittleEndian.Uint32(data[0x3C:])
+
+	// A huge preview with hardly any data to describe it.
+	damaged := append([]byte(nil), data...)
+	binary.LittleEndian.PutUint32(damaged[previewHeaderOffset:], 4096)
+	binary.LittleEndian.PutUint32(damaged[previewHeaderOffset+4:], 4096)
+	_, err := Decode(bytes.NewReader(damaged))
+	if !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("decoding a 4096x4096 preview gave %v, expected ErrOutOfRange", err)
+	}
+
+	// Long runs of fill, far more than the image has pixels.
+	var runs []uint16
+	for i := 0; i < 1<<18; i++ {
+		runs = append(runs, CombineRGB5515(0xFF, 0, 0, true), 0xFFF)
+	}
+	start := time.Now()
+	img := decodePreview(runs, 16, 16)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("decoding runs past the end of the preview took %v", elapsed)
+	}
+	if img.Bounds() != image.Rect(0, 0, 16, 16) || img.RGBAAt(15, 15).R == 0 {
+		t.Error("preview not filled")
+	}
+}
+
+func TestShortPreview(t *testing.T) {
+	data := encodeTest(t, testFile(t, Version1, 0))
+	previewHeaderOffset := binary.LittleEndian.Uint32(data[0x3C:])
+
+	// The missing pixels are left blank.
+	damaged := append([]byte(nil), data...)
+	binary.LittleEndian.PutUint32(damaged[previewHeaderOffset+0x0C:], 0)
+	pf, err := Decode(bytes.NewReader(damaged))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pf.PreviewImage.Bounds() != image.Rect(0, 0, 32, 24) || pf.PreviewImage.RGBAAt(31, 23) != PixelSetColor {
+		t.Errorf("preview is %v, last pixel %v", pf.PreviewImage.Bounds(), pf.PreviewImage.RGBAAt(31, 23))
+	}
+}
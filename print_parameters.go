@@ -0,0 +1,87 @@
+package photon
+
+// Extended print settings, only present in version 2 files.
+type PrintParameters struct {
+	BottomLiftDistance  float32 // mm
+	BottomLiftSpeed     float32 // mm/min
+	LiftDistance        float32 // mm
+	LiftSpeed           float32 // mm/min
+	RetractSpeed        float32 // mm/min
+	Volume              float32 // ml
+	Weight              float32 // g
+	Cost                float32 // In the slicer's currency
+	BottomLightOffDelay float32 // seconds
+	LightOffDelay       float32 // seconds
+	BottomLayers        uint32
+
+	// Print parameter fields we don't understand yet, kept so they can be written back unchanged.
+	Extra PrintParametersExtra
+}
+
+// Raw values of the unknown binCompatPrintParameters fields, named by their offset.
+type PrintParametersExtra struct {
+	Field_2C uint32
+	Field_30 uint32
+	Field_34 uint32
+	Field_38 uint32
+}
+
+type binCompatPrintParameters struct {
+	BottomLiftDistance  float32
+	BottomLiftSpeed     float32
+	LiftDistance        float32
+	LiftSpeed           float32
+	RetractSpeed        float32
+	Volume              float32
+	Weight              float32
+	Cost                float32
+	BottomLightOffDelay float32
+	LightOffDelay       float32
+	BottomLayers        uint32
+	Field_2C            uint32 // Always 0?
+	Field_30            uint32 // Always 0?
+	Field_34            uint32 // Always 0?
+	Field_38            uint32 // Always 0?
+}
+
+func (p binCompatPrintParameters) toPrintParameters() PrintParameters {
+	return PrintParameters{
+		BottomLiftDistance:  p.BottomLiftDistance,
+		BottomLiftSpeed:     p.BottomLiftSpeed,
+		LiftDistance:        p.LiftDistance,
+		LiftSpeed:           p.LiftSpeed,
+		RetractSpeed:        p.RetractSpeed,
+		Volume:              p.Volume,
+		Weight:              p.Weight,
+		Cost:                p.Cost,
+		BottomLightOffDelay: p.BottomLightOffDelay,
+		LightOffDelay:       p.LightOffDelay,
+		BottomLayers:        p.BottomLayers,
+		Extra: PrintParametersExtra{
+			Field_2C: p.Field_2C,
+			Field_30: p.Field_30,
+			Field_34: p.Field_34,
+			Field_38: p.Field_38,
+		},
+	}
+}
+
+func (p PrintParameters) toBinCompat() binCompatPrintParameters {
+	return binCompatPrintParameters{
+		BottomLiftDistance:  p.BottomLiftDistance,
+		BottomLiftSpeed:     p.BottomLiftSpeed,
+		LiftDistance:        p.LiftDistance,
+		LiftSpeed:           p.LiftSpeed,
+		RetractSpeed:        p.RetractSpeed,
+		Volume:              p.Volume,
+		Weight:              p.Weight,
+		Cost:                p.Cost,
+		BottomLightOffDelay: p.BottomLightOffDelay,
+		LightOffDelay:       p.LightOffDelay,
+		BottomLayers:        p.BottomLayers,
+		Field_2C:            p.Extra.Field_2C,
+		Field_30:            p.Extra.Field_30,
+		Field_34:            p.Extra.Field_34,
+		Field_38:            p.Extra.Field_38,
+	}
+}
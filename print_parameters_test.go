@@ -0,0 +1,66 @@
+package photon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestUpgradePrintParameters(t *testing.T) {
+	pf, err := Decode(bytes.NewReader(encodeTest(t, testFile(t, Version1, 0))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pf.Version = Version2
+	upgraded, err := Decode(bytes.NewReader(encodeTest(t, pf)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pp := upgraded.PrintParameters
+	if pp.LiftDistance != defaultLiftDistance || pp.LiftSpeed != defaultLiftSpeed || pp.BottomLayers != 2 || pp.LightOffDelay != upgraded.OffTime {
+		t.Errorf("upgraded file has print parameters %+v", pp)
+	}
+}
+
+func TestPrintParametersRoundTrip(t *testing.T) {
+	t.Run("all zero", func(t *testing.T) {
+		pf := testFile(t, Version2, 0)
+		pf.PrintParameters = PrintParameters{}
+		data := encodeTest(t, pf)
+
+		decoded, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded.PrintParameters != (PrintParameters{}) {
+			t.Errorf("print parameters are %+v, expected all zero", decoded.PrintParameters)
+		}
+		if !bytes.Equal(encodeTest(t, decoded), data) {
+			t.Error("re-encoded file differs")
+		}
+	})
+
+	t.Run("absent", func(t *testing.T) {
+		pf := testFile(t, Version2, 0)
+		pf.Layout = &Layout{DeduplicateLayerData: true}
+		for _, ls := range DefaultLayout.Sections {
+			if ls.Section != SectionPrintParameters {
+				pf.Layout.Sections = append(pf.Layout.Sections, ls)
+			}
+		}
+		data := encodeTest(t, pf)
+		if offset := binary.LittleEndian.Uint32(data[0x54:]); offset != 0 {
+			t.Fatalf("print parameters written at 0x%X", offset)
+		}
+
+		decoded, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again := encodeTest(t, decoded); !bytes.Equal(again, data) {
+			t.Errorf("re-encoded file is %d bytes, expected %d", len(again), len(data))
+		}
+	})
+}
@@ -0,0 +1,116 @@
+package photon
+
+import "image"
+
+// Describes a printer, and the settings a new file for it starts out with.
+// See the profiles package for the known printers.
+type Profile struct {
+	Name        string // e.g. "Elegoo Mars"
+	MachineName string // Stored in version 2 files, some firmware checks it.
+	Version     uint32 // File format version the printer expects.
+
+	PlateX, PlateY, PlateZ    float32 // Build volume in mm.
+	ScreenWidth, ScreenHeight uint32  // In pixels.
+	LightCuringType           LightCuringType
+	AntiAliasLevel            uint32 // Version 2 only.
+
+	// Sizes of the preview images the printer shows, DefaultPreviewSize / DefaultThumbnailSize if zero.
+	PreviewSize   image.Point
+	ThumbnailSize image.Point
+
+	// Print settings, those left at zero get the defaults below.
+	LayerThickness     float32
+	NormalExposureTime float32
+	BottomExposureTime float32
+	OffTime            float32
+	BottomLayers       uint32
+	PrintParameters    PrintParameters // Stored in version 2 files only.
+}
+
+// Print settings New uses for anything the profile leaves at zero.
+// They suit a typical resin on a 2K LCD printer like the Elegoo Mars.
+const (
+	defaultLayerThickness     = 0.05
+	defaultNormalExposureTime = 8
+	defaultBottomExposureTime = 60
+	defaultOffTime            = 1
+	defaultBottomLayers       = 6
+	defaultLiftDistance       = 5
+	defaultLiftSpeed          = 60
+	defaultRetractSpeed       = 150
+)
+
+// Creates a file for the printer described by the profile, with blank previews of the
+// right size and no layers. Settings the profile leaves at zero get sensible defaults.
+func New(profile Profile) *PhotonFile {
+	orDefault := func(v float32, def float32) float32 {
+		if v == 0 {
+			return def
+		}
+		return v
+	}
+
+	previewSize := profile.PreviewSize
+	if previewSize == image.ZP {
+		previewSize = DefaultPreviewSize
+	}
+	thumbnailSize := profile.ThumbnailSize
+	if thumbnailSize == image.ZP {
+		thumbnailSize = DefaultThumbnailSize
+	}
+
+	bottomLayers := profile.BottomLayers
+	if bottomLayers == 0 {
+		bottomLayers = defaultBottomLayers
+	}
+
+	pf := &PhotonFile{
+		Version:            profile.Version,
+		PlateX:             profile.PlateX,
+		PlateY:             profile.PlateY,
+		PlateZ:             profile.PlateZ,
+		LayerThickness:     orDefault(profile.LayerThickness, defaultLayerThickness),
+		NormalExposureTime: orDefault(profile.NormalExposureTime, defaultNormalExposureTime),
+		BottomExposureTime: orDefault(profile.BottomExposureTime, defaultBottomExposureTime),
+		OffTime:            orDefault(profile.OffTime, defaultOffTime),
+		BottomLayers:       bottomLayers,
+		ScreenWidth:        profile.ScreenWidth,
+		ScreenHeight:       profile.ScreenHeight,
+		LightCuringType:    profile.LightCuringType,
+
+		PreviewImage:   blankPreview(previewSize),
+		ThumbnailImage: blankPreview(thumbnailSize),
+	}
+
+	// Version 1 files get print parameters too, in case they're upgraded later.
+	pf.PrintParameters = pf.printParametersWithDefaults(profile.PrintParameters)
+	if pf.Version >= Version2 {
+		pf.MachineName = profile.MachineName
+		pf.AntiAliasLevel = profile.AntiAliasLevel
+	}
+
+	return pf
+}
+
+// printParametersWithDefaults fills in the print parameters left at zero with the defaults
+// above, and those that follow the file's own settings from pf.
+func (pf *PhotonFile) printParametersWithDefaults(pp PrintParameters) PrintParameters {
+	orDefault := func(v float32, def float32) float32 {
+		if v == 0 {
+			return def
+		}
+		return v
+	}
+
+	pp.BottomLiftDistance = orDefault(pp.BottomLiftDistance, defaultLiftDistance)
+	pp.BottomLiftSpeed = orDefault(pp.BottomLiftSpeed, defaultLiftSpeed)
+	pp.LiftDistance = orDefault(pp.LiftDistance, defaultLiftDistance)
+	pp.LiftSpeed = orDefault(pp.LiftSpeed, defaultLiftSpeed)
+	pp.RetractSpeed = orDefault(pp.RetractSpeed, defaultRetractSpeed)
+	pp.BottomLightOffDelay = orDefault(pp.BottomLightOffDelay, pf.OffTime)
+	pp.LightOffDelay = orDefault(pp.LightOffDelay, pf.OffTime)
+	if pp.BottomLayers == 0 {
+		pp.BottomLayers = pf.BottomLayers
+	}
+	return pp
+}
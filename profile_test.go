@@ -0,0 +1,39 @@
+package photon
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	pf := New(Profile{
+		Version:      Version2,
+		MachineName:  "Test Printer",
+		PlateX:       68.04,
+		PlateY:       120.96,
+		PlateZ:       150,
+		ScreenWidth:  1440,
+		ScreenHeight: 2560,
+		OffTime:      2,
+	})
+
+	if pf.PreviewImage.Bounds().Size() != DefaultPreviewSize || pf.ThumbnailImage.Bounds().Size() != DefaultThumbnailSize {
+		t.Errorf("previews are %v and %v", pf.PreviewImage.Bounds(), pf.ThumbnailImage.Bounds())
+	}
+	if pf.LayerThickness != defaultLayerThickness || pf.BottomLayers != defaultBottomLayers || pf.OffTime != 2 {
+		t.Errorf("settings are %v, %v, %v", pf.LayerThickness, pf.BottomLayers, pf.OffTime)
+	}
+	pp := pf.PrintParameters
+	if pp.LiftSpeed != defaultLiftSpeed || pp.LightOffDelay != 2 || pp.BottomLayers != defaultBottomLayers {
+		t.Errorf("print parameters are %+v", pp)
+	}
+
+	data := encodeTest(t, pf)
+	decoded, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.MachineName != "Test Printer" || len(decoded.Layers) != 0 {
+		t.Errorf("decoded %q with %d layers", decoded.MachineName, len(decoded.Layers))
+	}
+}
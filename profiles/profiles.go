@@ -0,0 +1,141 @@
+// Package profiles is a database of known printers, for creating files with photon.New.
+//
+//	pf := photon.New(profiles.ElegooMars)
+//
+// More printers can be added with Register, or loaded from JSON with Load.
+package profiles
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Andoryuuta/photon"
+)
+
+// The built-in printers.
+var (
+	AnycubicPhoton = photon.Profile{
+		Name:            "Anycubic Photon",
+		Version:         photon.Version1,
+		PlateX:          68.04,
+		PlateY:          120.96,
+		PlateZ:          155,
+		ScreenWidth:     1440,
+		ScreenHeight:    2560,
+		LightCuringType: photon.LightCuringLCDMirror,
+	}
+
+	ElegooMars = photon.Profile{
+		Name:            "Elegoo Mars",
+		Version:         photon.Version2,
+		MachineName:     "ELEGOO MARS",
+		PlateX:          68.04,
+		PlateY:          120.96,
+		PlateZ:          150,
+		ScreenWidth:     1440,
+		ScreenHeight:    2560,
+		LightCuringType: photon.LightCuringLCDMirror,
+		AntiAliasLevel:  1,
+	}
+
+	ElegooMarsPro = photon.Profile{
+		Name:            "Elegoo Mars Pro",
+		Version:         photon.Version2,
+		MachineName:     "ELEGOO MARS PRO",
+		PlateX:          68.04,
+		PlateY:          120.96,
+		PlateZ:          150,
+		ScreenWidth:     1440,
+		ScreenHeight:    2560,
+		LightCuringType: photon.LightCuringLCDMirror,
+		AntiAliasLevel:  1,
+	}
+)
+
+var (
+	mu       sync.Mutex
+	profiles = map[string]photon.Profile{}
+)
+
+func init() {
+	Register(AnycubicPhoton, ElegooMars, ElegooMarsPro)
+}
+
+// key is the name profiles are looked up by, so that "elegoo mars" finds "Elegoo Mars".
+func key(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// Adds profiles to the database, replacing any already there with the same name.
+func Register(ps ...photon.Profile) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, p := range ps {
+		profiles[key(p.Name)] = p
+	}
+}
+
+// Finds the profile with the given name, ignoring case.
+func Lookup(name string) (photon.Profile, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	p, ok := profiles[key(name)]
+	return p, ok
+}
+
+// Returns every profile in the database, sorted by name.
+func All() []photon.Profile {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var all []photon.Profile
+	for _, p := range profiles {
+		all = append(all, p)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Name < all[j].Name
+	})
+	return all
+}
+
+// Reads a JSON array of profiles, using the photon.Profile field names, and registers them.
+// Profiles need at least a Name, a screen size and a plate size.
+func Load(r io.Reader) ([]photon.Profile, error) {
+	var ps []photon.Profile
+	err := json.NewDecoder(r).Decode(&ps)
+	if err != nil {
+		return nil, fmt.Errorf("profiles: %v", err)
+	}
+
+	for i, p := range ps {
+		err = check(p)
+		if err != nil {
+			return nil, fmt.Errorf("profiles: profile %d: %v", i, err)
+		}
+	}
+
+	Register(ps...)
+	return ps, nil
+}
+
+// check makes sure a loaded profile has the settings photon.New can't make up.
+func check(p photon.Profile) error {
+	switch {
+	case key(p.Name) == "":
+		return errors.New("missing Name")
+	case p.ScreenWidth == 0 || p.ScreenHeight == 0:
+		return fmt.Errorf("%q has no screen size", p.Name)
+	case p.PlateX <= 0 || p.PlateY <= 0 || p.PlateZ <= 0:
+		return fmt.Errorf("%q has no plate size", p.Name)
+	case p.Version != 0 && p.Version != photon.Version1 && p.Version != photon.Version2:
+		return fmt.Errorf("%q has unsupported version %d", p.Name, p.Version)
+	}
+	return nil
+}
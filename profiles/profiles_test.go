@@ -0,0 +1,61 @@
+package profiles
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	p, ok := Lookup(" elegoo MARS ")
+	if !ok || p.Name != "Elegoo Mars" {
+		t.Errorf("Lookup gave %q, %v", p.Name, ok)
+	}
+	if _, ok := Lookup("No Such Printer"); ok {
+		t.Error("found a printer that isn't there")
+	}
+
+	for _, p := range All() {
+		err := check(p)
+		if err != nil {
+			t.Errorf("built-in profile: %v", err)
+		}
+		g := float64(p.PlateX) / float64(p.ScreenWidth)
+		if g < 0.02 || g > 0.1 {
+			t.Errorf("%q has a %v mm pixel pitch", p.Name, g)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	ps, err := Load(strings.NewReader(`[{
+		"Name": "Test Printer", "Version": 2, "MachineName": "TEST",
+		"PlateX": 68.04, "PlateY": 120.96, "PlateZ": 150,
+		"ScreenWidth": 1440, "ScreenHeight": 2560, "LightCuringType": 1
+	}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps) != 1 || ps[0].MachineName != "TEST" {
+		t.Errorf("loaded %+v", ps)
+	}
+	if _, ok := Lookup("test printer"); !ok {
+		t.Error("loaded profile not registered")
+	}
+
+	bad := []string{
+		`{`,
+		`[{"ScreenWidth": 1440, "ScreenHeight": 2560, "PlateX": 68, "PlateY": 120, "PlateZ": 150}]`,
+		`[{"Name": "No Screen", "PlateX": 68, "PlateY": 120, "PlateZ": 150}]`,
+		`[{"Name": "No Plate", "ScreenWidth": 1440, "ScreenHeight": 2560}]`,
+		`[{"Name": "Version 3", "Version": 3, "ScreenWidth": 1440, "ScreenHeight": 2560, "PlateX": 68, "PlateY": 120, "PlateZ": 150}]`,
+	}
+	for _, data := range bad {
+		_, err := Load(strings.NewReader(data))
+		if err == nil {
+			t.Errorf("loaded %s", data)
+		}
+	}
+	if _, ok := Lookup("no screen"); ok {
+		t.Error("registered a profile that failed to load")
+	}
+}
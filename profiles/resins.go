@@ -0,0 +1,108 @@
+package profiles
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/Andoryuuta/photon"
+)
+
+// Resins are keyed by resin and printer name, since the same resin needs different settings on different printers.
+type resinKey struct {
+	resin   string
+	printer string
+}
+
+var resins = map[resinKey]photon.ResinProfile{}
+
+// Adds resin profiles to the database, replacing any already there for the same resin and printer.
+func RegisterResin(rs ...photon.ResinProfile) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, r := range rs {
+		resins[resinKey{key(r.Name), key(r.Printer)}] = r
+	}
+}
+
+// Finds the resin profile with the given name, ignoring case. A profile tuned for the
+// given printer is preferred, falling back on one with no Printer. When printer is ""
+// (e.g. the file doesn't say), the only profile with that name will do if there's just
+// one. Use ResinPrinters to list the choices otherwise.
+func LookupResin(name string, printer string) (photon.ResinProfile, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	r, ok := resins[resinKey{key(name), key(printer)}]
+	if !ok {
+		r, ok = resins[resinKey{key(name), ""}]
+	}
+	if !ok && key(printer) == "" {
+		matches := 0
+		for k, kr := range resins {
+			if k.resin == key(name) {
+				r = kr
+				matches++
+			}
+		}
+		ok = matches == 1
+	}
+	if !ok {
+		return photon.ResinProfile{}, false
+	}
+	return r, ok
+}
+
+// Returns the printers there are profiles for the named resin for, sorted. A profile
+// for any printer is listed as "".
+func ResinPrinters(name string) []string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var printers []string
+	for _, r := range resins {
+		if key(r.Name) == key(name) {
+			printers = append(printers, r.Printer)
+		}
+	}
+	sort.Strings(printers)
+	return printers
+}
+
+// Returns every resin profile in the database, sorted by name and then printer.
+func AllResins() []photon.ResinProfile {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var all []photon.ResinProfile
+	for _, r := range resins {
+		all = append(all, r)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Name != all[j].Name {
+			return all[i].Name < all[j].Name
+		}
+		return all[i].Printer < all[j].Printer
+	})
+	return all
+}
+
+// Reads a JSON array of resin profiles, using the photon.ResinProfile field names, and registers them.
+func LoadResins(r io.Reader) ([]photon.ResinProfile, error) {
+	var rs []photon.ResinProfile
+	err := json.NewDecoder(r).Decode(&rs)
+	if err != nil {
+		return nil, fmt.Errorf("profiles: %v", err)
+	}
+
+	for i, r := range rs {
+		if key(r.Name) == "" {
+			return nil, fmt.Errorf("profiles: resin profile %d: missing Name", i)
+		}
+	}
+
+	RegisterResin(rs...)
+	return rs, nil
+}
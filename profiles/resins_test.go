@@ -0,0 +1,69 @@
+package profiles
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Andoryuuta/photon"
+)
+
+func TestLookupResin(t *testing.T) {
+	RegisterResin(
+		photon.ResinProfile{Name: "Test Grey", NormalExposureTime: 8},
+		photon.ResinProfile{Name: "Test Grey", Printer: "Elegoo Mars", NormalExposureTime: 7},
+		photon.ResinProfile{Name: "Test Mars Only", Printer: "Elegoo Mars", NormalExposureTime: 6},
+		photon.ResinProfile{Name: "Test Two Printers", Printer: "Elegoo Mars", NormalExposureTime: 5},
+		photon.ResinProfile{Name: "Test Two Printers", Printer: "Anycubic Photon", NormalExposureTime: 9},
+	)
+
+	tests := []struct {
+		name     string
+		printer  string
+		ok       bool
+		exposure float32
+	}{
+		{"test grey", "ELEGOO MARS", true, 7},
+		{"Test Grey", "Anycubic Photon", true, 8},
+		{"Test Grey", "", true, 8},
+		{"Test Mars Only", "", true, 6},
+		{"Test Mars Only", "Anycubic Photon", false, 0},
+		{"Test Two Printers", "", false, 0},
+		{"Test Two Printers", "Anycubic Photon", true, 9},
+		{"No Such Resin", "", false, 0},
+	}
+	for _, tt := range tests {
+		r, ok := LookupResin(tt.name, tt.printer)
+		if ok != tt.ok || r.NormalExposureTime != tt.exposure {
+			t.Errorf("LookupResin(%q, %q) = %v, %v, expected exposure %v, %v", tt.name, tt.printer, r.NormalExposureTime, ok, tt.exposure, tt.ok)
+		}
+	}
+
+	printers := ResinPrinters("test two printers")
+	if len(printers) != 2 || printers[0] != "Anycubic Photon" || printers[1] != "Elegoo Mars" {
+		t.Errorf("ResinPrinters gave %q", printers)
+	}
+}
+
+func TestLoadResins(t *testing.T) {
+	rs, err := LoadResins(strings.NewReader(`[
+		{"Name": "Test Loaded", "Printer": "Elegoo Mars", "NormalExposureTime": 7.5, "LiftSpeed": 90}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 1 || rs[0].LiftSpeed != 90 {
+		t.Errorf("loaded %+v", rs)
+	}
+	if r, ok := LookupResin("test loaded", "elegoo mars"); !ok || r.NormalExposureTime != 7.5 {
+		t.Errorf("loaded resin not registered, got %+v", r)
+	}
+
+	_, err = LoadResins(strings.NewReader(`[{"Printer": "Elegoo Mars"}]`))
+	if err == nil {
+		t.Error("loaded a resin without a name")
+	}
+	_, err = LoadResins(strings.NewReader(`{`))
+	if err == nil {
+		t.Error("loaded malformed JSON")
+	}
+}
@@ -0,0 +1,40 @@
+package photon
+
+import "fmt"
+
+// How the printer exposes each layer, which decides whether the layer images are stored mirrored.
+type LightCuringType uint32
+
+const (
+	LightCuringCast      LightCuringType = 0 // Projector, layer images are stored as the model is.
+	LightCuringLCDMirror LightCuringType = 1 // LCD, layer images are stored mirrored left to right.
+)
+
+func (t LightCuringType) String() string {
+	switch t {
+	case LightCuringCast:
+		return "cast"
+	case LightCuringLCDMirror:
+		return "LCD mirror"
+	}
+	return fmt.Sprintf("LightCuringType(%d)", uint32(t))
+}
+
+// MirrorX reports whether layer images are stored mirrored left to right.
+func (t LightCuringType) MirrorX() bool {
+	return t == LightCuringLCDMirror
+}
+
+// Returns how the printer the file is for exposes each layer.
+func (pf *PhotonFile) Projection() LightCuringType {
+	return pf.LightCuringType
+}
+
+// layerX maps an x coordinate between the stored layer image and the model, which are
+// mirror images of each other for some projections. It is its own inverse.
+func (pf *PhotonFile) layerX(x int) int {
+	if pf.Projection().MirrorX() {
+		return int(pf.ScreenWidth) - 1 - x
+	}
+	return x
+}
@@ -0,0 +1,63 @@
+package photon
+
+import (
+	"fmt"
+	"io"
+)
+
+// Reader gives random access to the layers of a file, only reading
+// each layer's image data when it is asked for.
+type Reader struct {
+	// File holds the decoded headers and previews. Its Layers have no RawData, see DecodeConfig.
+	File *PhotonFile
+
+	sr     *sectionReader
+	layers *layerTable
+}
+
+// Parses the headers of a .photon / .cbddlp file of the given size.
+// Layer data is read from r on demand, so r must stay open for as long as the Reader is used.
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	sr := &sectionReader{rdr: r, size: size}
+
+	pf, lt, err := decodeHeaders(sr, true, defaultDecodeLimits, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Reader{
+		File:   pf,
+		sr:     sr,
+		layers: lt,
+	}, nil
+}
+
+// Returns the number of layers in the file.
+func (r *Reader) NumLayers() int {
+	return len(r.File.Layers)
+}
+
+// Returns the given layer, with its image data and any anti-aliasing levels read in.
+// It is safe to call concurrently if the underlying io.ReaderAt is.
+func (r *Reader) Layer(layerIdx int) (Layer, error) {
+	if layerIdx < 0 || layerIdx >= len(r.File.Layers) {
+		return Layer{}, fmt.Errorf("photon: layer %d out of range", layerIdx)
+	}
+
+	layer := r.File.Layers[layerIdx]
+	layer.AntiAliasRawData = nil
+	for idx := layerIdx; idx < len(r.layers.headers); idx += len(r.File.Layers) {
+		imageData, err := r.sr.readLayerData(r.layers, idx)
+		if err != nil {
+			return Layer{}, err
+		}
+
+		if idx == layerIdx {
+			layer.RawData = imageData
+		} else {
+			layer.AntiAliasRawData = append(layer.AntiAliasRawData, imageData)
+		}
+	}
+
+	return layer, nil
+}
@@ -0,0 +1,55 @@
+package photon
+
+import (
+	"bytes"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestReader(t *testing.T) {
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data := encodeTest(t, tc.pf(t))
+			pf, err := Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.NumLayers() != len(pf.Layers) || r.File.MachineName != pf.MachineName || r.File.Layers[0].RawData != nil {
+				t.Fatalf("Reader has %d layers, expected %d", r.NumLayers(), len(pf.Layers))
+			}
+
+			// Layers can be read in any order, and at the same time.
+			var wg sync.WaitGroup
+			for idx := len(pf.Layers) - 1; idx >= 0; idx-- {
+				wg.Add(1)
+				go func(idx int) {
+					defer wg.Done()
+					layer, err := r.Layer(idx)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if !reflect.DeepEqual(layer, pf.Layers[idx]) {
+						t.Errorf("layer %d differs from Decode's", idx)
+					}
+				}(idx)
+			}
+			wg.Wait()
+
+			if _, err := r.Layer(len(pf.Layers)); err == nil {
+				t.Error("read a layer out of range")
+			}
+		})
+	}
+
+	data := encodeTest(t, testFile(t, Version1, 0))
+	if _, err := NewReader(bytes.NewReader(data), 0x40); err == nil {
+		t.Error("read a truncated header")
+	}
+}
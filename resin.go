@@ -0,0 +1,86 @@
+package photon
+
+import "fmt"
+
+// Tuned print settings for a resin, for use with ApplyResinProfile.
+// Settings left at zero are kept as they are in the file.
+type ResinProfile struct {
+	Name    string // e.g. "Elegoo Standard Grey"
+	Printer string // Name of the printer profile the settings were tuned on, if any.
+
+	NormalExposureTime float32 // seconds
+	BottomExposureTime float32 // seconds
+	OffTime            float32 // seconds
+	BottomLayers       uint32
+
+	// Only stored in version 2 files, ignored for version 1.
+	BottomLiftDistance  float32 // mm
+	BottomLiftSpeed     float32 // mm/min
+	LiftDistance        float32 // mm
+	LiftSpeed           float32 // mm/min
+	RetractSpeed        float32 // mm/min
+	BottomLightOffDelay float32 // seconds
+	LightOffDelay       float32 // seconds
+}
+
+// Applies the resin's settings to the file header, and rewrites every layer's exposure and
+// off time to match: BottomExposureTime for the first BottomLayers layers, NormalExposureTime
+// for the rest, and OffTime for all of them. Lift settings are only applied to version 2 files.
+func (pf *PhotonFile) ApplyResinProfile(resin ResinProfile) error {
+	settings := []struct {
+		name  string
+		value float32
+	}{
+		{"NormalExposureTime", resin.NormalExposureTime},
+		{"BottomExposureTime", resin.BottomExposureTime},
+		{"OffTime", resin.OffTime},
+		{"BottomLiftDistance", resin.BottomLiftDistance},
+		{"BottomLiftSpeed", resin.BottomLiftSpeed},
+		{"LiftDistance", resin.LiftDistance},
+		{"LiftSpeed", resin.LiftSpeed},
+		{"RetractSpeed", resin.RetractSpeed},
+		{"BottomLightOffDelay", resin.BottomLightOffDelay},
+		{"LightOffDelay", resin.LightOffDelay},
+	}
+	for _, s := range settings {
+		if s.value < 0 {
+			return fmt.Errorf("photon: resin profile %q has negative %s (%v)", resin.Name, s.name, s.value)
+		}
+	}
+
+	set := func(field *float32, value float32) {
+		if value != 0 {
+			*field = value
+		}
+	}
+
+	set(&pf.NormalExposureTime, resin.NormalExposureTime)
+	set(&pf.BottomExposureTime, resin.BottomExposureTime)
+	set(&pf.OffTime, resin.OffTime)
+	if resin.BottomLayers != 0 {
+		pf.BottomLayers = resin.BottomLayers
+	}
+
+	if pf.Version >= Version2 {
+		pp := &pf.PrintParameters
+		set(&pp.BottomLiftDistance, resin.BottomLiftDistance)
+		set(&pp.BottomLiftSpeed, resin.BottomLiftSpeed)
+		set(&pp.LiftDistance, resin.LiftDistance)
+		set(&pp.LiftSpeed, resin.LiftSpeed)
+		set(&pp.RetractSpeed, resin.RetractSpeed)
+		set(&pp.BottomLightOffDelay, resin.BottomLightOffDelay)
+		set(&pp.LightOffDelay, resin.LightOffDelay)
+		pp.BottomLayers = pf.BottomLayers
+	}
+
+	for idx := range pf.Layers {
+		l := &pf.Layers[idx]
+		l.ExposureTime = pf.NormalExposureTime
+		if uint32(idx) < pf.BottomLayers {
+			l.ExposureTime = pf.BottomExposureTime
+		}
+		l.PerLayerOffTime = pf.OffTime
+	}
+
+	return nil
+}
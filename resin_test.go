@@ -0,0 +1,47 @@
+package photon
+
+import "testing"
+
+func TestApplyResinProfile(t *testing.T) {
+	for _, version := range []uint32{Version1, Version2} {
+		pf := testFile(t, version, 0)
+		err := pf.ApplyResinProfile(ResinProfile{
+			Name:               "Test",
+			NormalExposureTime: 7,
+			BottomExposureTime: 50,
+			BottomLayers:       3,
+			LiftSpeed:          90,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if pf.NormalExposureTime != 7 || pf.BottomExposureTime != 50 || pf.BottomLayers != 3 || pf.OffTime != defaultOffTime {
+			t.Errorf("version %d: header settings are %v, %v, %v, %v", version, pf.NormalExposureTime, pf.BottomExposureTime, pf.BottomLayers, pf.OffTime)
+		}
+		for idx, l := range pf.Layers {
+			want := float32(7)
+			if idx < 3 {
+				want = 50
+			}
+			if l.ExposureTime != want || l.PerLayerOffTime != defaultOffTime {
+				t.Errorf("version %d: layer %d has exposure %v and off time %v", version, idx, l.ExposureTime, l.PerLayerOffTime)
+			}
+		}
+
+		// Lift settings are only stored in version 2 files.
+		wantLiftSpeed := float32(defaultLiftSpeed)
+		if version >= Version2 {
+			wantLiftSpeed = 90
+		}
+		if pf.PrintParameters.LiftSpeed != wantLiftSpeed {
+			t.Errorf("version %d: LiftSpeed is %v, expected %v", version, pf.PrintParameters.LiftSpeed, wantLiftSpeed)
+		}
+	}
+
+	pf := testFile(t, Version2, 0)
+	err := pf.ApplyResinProfile(ResinProfile{Name: "Bad", OffTime: -1})
+	if err == nil {
+		t.Error("applied a negative OffTime")
+	}
+}
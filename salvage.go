@@ -0,0 +1,65 @@
+package photon
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// Describes what DecodeSalvage had to leave out of a damaged file.
+type SalvageReport struct {
+	// Every section that couldn't be read, as *FormatError.
+	Problems []error
+
+	// Number of layers the file header claims to have.
+	TotalLayers uint32
+
+	// Indices (in the damaged file) of the layers that were dropped because their
+	// headers or image data couldn't be read, or the image data doesn't cover the screen.
+	BrokenLayers []int
+}
+
+// Decodes as much of a truncated or partially corrupted file as it can.
+// Only a bad main header makes it fail; unreadable previews, print parameters
+// and machine info are left empty, and broken layers are dropped from Layers.
+// The surviving layers keep their AbsoluteHeight. Everything left out is listed
+// in the returned report.
+//
+// Re-encoding the result with EncodeTo gives a file with consistent offsets and layer count.
+func DecodeSalvage(rdr io.ReadSeeker) (*PhotonFile, *SalvageReport, error) {
+	report := &SalvageReport{}
+	pf, err := decode(context.Background(), rdr, nil, true, true, report)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pf, report, nil
+}
+
+// salvage notes err in the report and returns nil.
+// When not salvaging (a nil report), or err is an I/O error rather than
+// a problem with the file, it returns err unchanged.
+func (r *SalvageReport) salvage(err error) error {
+	var formatErr *FormatError
+	if r == nil || err == nil || !errors.As(err, &formatErr) {
+		return err
+	}
+	r.Problems = append(r.Problems, err)
+	return nil
+}
+
+// dropBrokenLayers removes the broken layers, recording them in the report along
+// with the layers past the end of a truncated layer header table.
+func (r *SalvageReport) dropBrokenLayers(layers []Layer, broken map[uint32]bool) []Layer {
+	var kept []Layer
+	for idx, layer := range layers {
+		if broken[uint32(idx)] {
+			r.BrokenLayers = append(r.BrokenLayers, idx)
+			continue
+		}
+		kept = append(kept, layer)
+	}
+	for idx := uint32(len(layers)); idx < r.TotalLayers; idx++ {
+		r.BrokenLayers = append(r.BrokenLayers, int(idx))
+	}
+	return kept
+}
@@ -0,0 +1,65 @@
+package photon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSalvage(t *testing.T) {
+	data := encodeTest(t, testFile(t, Version1, 0))
+	layerHeadersOffset := binary.LittleEndian.Uint32(data[0x40:])
+
+	t.Run("intact", func(t *testing.T) {
+		pf, report, err := DecodeSalvage(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pf.Layers) != 6 || report.TotalLayers != 6 || len(report.BrokenLayers) != 0 || len(report.Problems) != 0 {
+			t.Errorf("got %d layers and report %+v", len(pf.Layers), report)
+		}
+	})
+
+	t.Run("truncated layer headers", func(t *testing.T) {
+		// Cut the file off part way through the third layer header.
+		_, report, err := DecodeSalvage(bytes.NewReader(data[:layerHeadersOffset+36*2+10]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.TotalLayers != 6 || !reflect.DeepEqual(report.BrokenLayers, []int{0, 1, 2, 3, 4, 5}) {
+			t.Errorf("broken layers are %v of %d, expected all of them", report.BrokenLayers, report.TotalLayers)
+		}
+	})
+
+	t.Run("damaged image data", func(t *testing.T) {
+		damaged := append([]byte(nil), data...)
+		dataOffset := binary.LittleEndian.Uint32(damaged[layerHeadersOffset+36+0x0C:])
+		damaged[dataOffset] ^= 1
+
+		pf, report, err := DecodeSalvage(bytes.NewReader(damaged))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pf.Layers) != 5 || !reflect.DeepEqual(report.BrokenLayers, []int{1}) {
+			t.Errorf("got %d layers, broken layers %v, expected only layer 1 to be dropped", len(pf.Layers), report.BrokenLayers)
+		}
+		if len(report.Problems) != 1 || !errors.Is(report.Problems[0], ErrBadImageData) {
+			t.Errorf("problems are %v", report.Problems)
+		}
+
+		// The survivors keep their heights, and re-encode to a consistent file.
+		intact, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pf.Layers[1].AbsoluteHeight != intact.Layers[2].AbsoluteHeight {
+			t.Errorf("layer 2 is at %v, expected %v", pf.Layers[1].AbsoluteHeight, intact.Layers[2].AbsoluteHeight)
+		}
+		_, err = Decode(bytes.NewReader(encodeTest(t, pf)))
+		if err != nil {
+			t.Error(err)
+		}
+	})
+}
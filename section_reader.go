@@ -0,0 +1,137 @@
+package photon
+
+import (
+	"encoding/binary"
+	"image"
+	"io"
+	"strings"
+)
+
+// sectionReader reads bounds-checked sections out of a stream of a known length.
+type sectionReader struct {
+	rdr  io.ReaderAt
+	size int64
+}
+
+// newSectionReader finds the length of rdr. Failing to seek is an I/O error rather than
+// a problem with the file, so it's returned as is.
+func newSectionReader(rdr io.ReadSeeker) (*sectionReader, error) {
+	size, err := rdr.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sectionReader{rdr: readSeekerAt{rdr}, size: size}, nil
+}
+
+// readSeekerAt adapts an io.ReadSeeker into an io.ReaderAt.
+// Unlike most ReaderAts, it is not safe for concurrent use.
+type readSeekerAt struct {
+	rs io.ReadSeeker
+}
+
+func (r readSeekerAt) ReadAt(p []byte, off int64) (int, error) {
+	_, err := r.rs.Seek(off, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+	return io.ReadFull(r.rs, p)
+}
+
+// check verifies that length bytes starting at offset lie entirely within the stream.
+func (sr *sectionReader) check(section string, offset int64, length uint64) error {
+	if offset < 0 || offset > sr.size || length > uint64(sr.size-offset) {
+		return &FormatError{Section: section, Offset: offset, Err: ErrOutOfRange}
+	}
+	return nil
+}
+
+// read reads data from the given absolute offset. Running out of data is wrapped in
+// a *FormatError for the named section, other I/O errors are returned as they are.
+func (sr *sectionReader) read(section string, offset int64, data interface{}) error {
+	size := binary.Size(data)
+	err := sr.check(section, offset, uint64(size))
+	if err != nil {
+		return err
+	}
+
+	err = binary.Read(io.NewSectionReader(sr.rdr, offset, int64(size)), binary.LittleEndian, data)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return &FormatError{Section: section, Offset: offset, Err: err}
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// readLayerData reads the image data for the idx'th entry of the layer header tables.
+// The span has already been validated by decodeHeaders.
+func (sr *sectionReader) readLayerData(lt *layerTable, idx int) ([]byte, error) {
+	imageData := make([]byte, lt.headers[idx].ImageDataSize)
+	err := sr.read(layerDataSection(idx, lt.totalLayers), lt.dataOffsets[idx], &imageData)
+	if err != nil {
+		return nil, err
+	}
+	return imageData, nil
+}
+
+// readMachineInfo reads the machine info block at the given offset, and the machine name it points to.
+// The name is returned without its NUL padding, and as it was in the file.
+func (sr *sectionReader) readMachineInfo(offset int64, machineInfo *binCompatMachineInfo) (string, []byte, error) {
+	err := sr.read("machine info", offset, machineInfo)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if machineInfo.MachineNameSize > maxMachineNameSize {
+		return "", nil, &FormatError{Section: "machine name", Offset: int64(machineInfo.MachineNameOffset), Err: ErrTooLarge}
+	}
+	nameData := make([]byte, machineInfo.MachineNameSize)
+	err = sr.read("machine name", int64(machineInfo.MachineNameOffset), &nameData)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return strings.TrimRight(string(nameData), "\x00"), nameData, nil
+}
+
+// readPreview reads a preview header at the given offset, and decodes the image it points to.
+// The encoded image data is returned as well, exactly as it was in the file.
+func (sr *sectionReader) readPreview(section string, offset int64) (*image.RGBA, []byte, binCompatPreviewHeader, error) {
+	var header binCompatPreviewHeader
+	err := sr.read(section+" header", offset, &header)
+	if err != nil {
+		return nil, nil, header, err
+	}
+
+	if header.Width > maxPreviewDim || header.Height > maxPreviewDim {
+		return nil, nil, header, &FormatError{Section: section + " header", Offset: offset, Err: ErrTooLarge}
+	}
+
+	// A fill run covers at most 0x1000 pixels with two words, so the data can't describe
+	// an image larger than that. Short data just leaves the rest of the image blank, but
+	// we won't allocate an image much larger than the data for it.
+	maxPixels := uint64(header.PreviewDataSize/2) * 0x800
+	if defaultPixels := uint64(DefaultPreviewSize.X * DefaultPreviewSize.Y); maxPixels < defaultPixels {
+		maxPixels = defaultPixels
+	}
+	if uint64(header.Width)*uint64(header.Height) > maxPixels {
+		return nil, nil, header, &FormatError{Section: section + " data", Offset: int64(header.PreviewDataOffset), Err: ErrOutOfRange}
+	}
+
+	dataOffset := int64(header.PreviewDataOffset)
+	err = sr.check(section+" data", dataOffset, uint64(header.PreviewDataSize))
+	if err != nil {
+		return nil, nil, header, err
+	}
+
+	data := make([]byte, header.PreviewDataSize)
+	err = sr.read(section+" data", dataOffset, &data)
+	if err != nil {
+		return nil, nil, header, err
+	}
+
+	return decodePreview(U8ToU16Slice(data), header.Height, header.Width), data, header, nil
+}
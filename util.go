@@ -63,6 +63,15 @@ func comparePixelBuf(x []uint16, y []uint16) bool {
 	return true
 }
 
+// U8ToU16Slice is the inverse of U16ToU8Slice, a trailing odd byte is dropped.
+func U8ToU16Slice(in []uint8) []uint16 {
+	out := make([]uint16, 0, len(in)/2)
+	for i := 0; i+1 < len(in); i += 2 {
+		out = append(out, uint16(in[i])|uint16(in[i+1])<<8)
+	}
+	return out
+}
+
 func U16ToU8Slice(in []uint16) []uint8 {
 	out := make([]byte, 0, 2*len(in))
 	for _, v := range in {
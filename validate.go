@@ -0,0 +1,117 @@
+package photon
+
+import (
+	"fmt"
+	"math"
+)
+
+type Severity int
+
+const (
+	SeverityWarning Severity = iota // Likely to print, but probably not as intended.
+	SeverityError                   // Likely to be rejected by the firmware or to fail the print.
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// A single problem found by Validate.
+type Problem struct {
+	Severity Severity
+	Layer    int // Index of the offending layer, or -1 if the problem is with the file as a whole.
+	Message  string
+}
+
+func (p Problem) String() string {
+	if p.Layer < 0 {
+		return fmt.Sprintf("%v: %s", p.Severity, p.Message)
+	}
+	return fmt.Sprintf("%v: layer %d: %s", p.Severity, p.Layer, p.Message)
+}
+
+// How far (in mm) a layer's height may stray from LayerThickness before it's reported.
+const layerHeightTolerance = 0.001
+
+// Checks the file for settings and layer data that printer firmware is likely to
+// reject or misprint, returning every problem found. A nil result means no problems.
+func (pf *PhotonFile) Validate() []Problem {
+	var problems []Problem
+	report := func(severity Severity, layer int, format string, args ...interface{}) {
+		problems = append(problems, Problem{
+			Severity: severity,
+			Layer:    layer,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	// File wide settings
+	if int64(pf.BottomLayers) > int64(len(pf.Layers)) {
+		report(SeverityError, -1, "BottomLayers (%d) is more than the number of layers (%d)", pf.BottomLayers, len(pf.Layers))
+	}
+	if pf.NormalExposureTime <= 0 {
+		report(SeverityError, -1, "NormalExposureTime (%v) must be positive", pf.NormalExposureTime)
+	}
+	if pf.BottomExposureTime <= 0 {
+		report(SeverityError, -1, "BottomExposureTime (%v) must be positive", pf.BottomExposureTime)
+	}
+	if pf.LayerThickness <= 0 {
+		report(SeverityError, -1, "LayerThickness (%v) must be positive", pf.LayerThickness)
+	}
+	if pf.ScreenWidth == 0 || pf.ScreenHeight == 0 {
+		report(SeverityError, -1, "screen size %vx%v is empty", pf.ScreenWidth, pf.ScreenHeight)
+	}
+	if pf.LightCuringType != LightCuringCast && pf.LightCuringType != LightCuringLCDMirror {
+		report(SeverityWarning, -1, "unknown %v, layer images may be mirrored", pf.LightCuringType)
+	}
+
+	// Per layer settings
+	screenPixels := uint64(pf.ScreenWidth) * uint64(pf.ScreenHeight)
+	for idx, layer := range pf.Layers {
+		if layer.ExposureTime <= 0 {
+			report(SeverityError, idx, "ExposureTime (%v) must be positive", layer.ExposureTime)
+		}
+
+		if layer.PerLayerOffTime != pf.OffTime {
+			report(SeverityWarning, idx, "PerLayerOffTime (%v) differs from OffTime (%v)", layer.PerLayerOffTime, pf.OffTime)
+		}
+
+		if idx > 0 {
+			step := float64(layer.AbsoluteHeight) - float64(pf.Layers[idx-1].AbsoluteHeight)
+			if step <= 0 {
+				report(SeverityError, idx, "AbsoluteHeight (%v) isn't above the previous layer (%v)", layer.AbsoluteHeight, pf.Layers[idx-1].AbsoluteHeight)
+			} else if math.Abs(step-float64(pf.LayerThickness)) > layerHeightTolerance {
+				report(SeverityWarning, idx, "height step (%.4f) disagrees with LayerThickness (%v)", step, pf.LayerThickness)
+			}
+		}
+
+		if pf.PlateZ > 0 && layer.AbsoluteHeight > pf.PlateZ {
+			report(SeverityError, idx, "AbsoluteHeight (%v) is above the build volume (PlateZ %v)", layer.AbsoluteHeight, pf.PlateZ)
+		}
+
+		// Layers from DecodeConfig have no image data to check.
+		if layer.RawData == nil {
+			continue
+		}
+
+		if pixels := layerImageDataPixels(layer.RawData); pixels != screenPixels {
+			report(SeverityError, idx, "image data covers %d pixels, expected %d", pixels, screenPixels)
+		}
+		if levels := pf.antiAliasLevels(pf.Version); len(layer.AntiAliasRawData) != levels-1 {
+			report(SeverityError, idx, "has %d anti-aliasing levels, expected %d", len(layer.AntiAliasRawData)+1, levels)
+		}
+		for level, data := range layer.AntiAliasRawData {
+			if pixels := layerImageDataPixels(data); pixels != screenPixels {
+				report(SeverityError, idx, "anti-aliasing level %d image data covers %d pixels, expected %d", level+1, pixels, screenPixels)
+			}
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,57 @@
+package photon
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	if problems := testFile(t, Version2, 4).Validate(); problems != nil {
+		t.Fatalf("valid file has problems %v", problems)
+	}
+
+	tests := []struct {
+		name     string
+		edit     func(pf *PhotonFile)
+		severity Severity
+		layer    int
+		message  string
+	}{
+		{"bottom layers", func(pf *PhotonFile) { pf.BottomLayers = 10 }, SeverityError, -1, "BottomLayers"},
+		{"exposure", func(pf *PhotonFile) { pf.NormalExposureTime = 0 }, SeverityError, -1, "NormalExposureTime"},
+		{"thickness", func(pf *PhotonFile) { pf.LayerThickness = -1 }, SeverityError, -1, "LayerThickness"},
+		{"screen", func(pf *PhotonFile) { pf.ScreenWidth = 0 }, SeverityError, -1, "screen size"},
+		{"projection", func(pf *PhotonFile) { pf.LightCuringType = 7 }, SeverityWarning, -1, "mirrored"},
+		{"layer exposure", func(pf *PhotonFile) { pf.Layers[3].ExposureTime = 0 }, SeverityError, 3, "ExposureTime"},
+		{"off time", func(pf *PhotonFile) { pf.Layers[2].PerLayerOffTime = 5 }, SeverityWarning, 2, "PerLayerOffTime"},
+		{"height order", func(pf *PhotonFile) { pf.Layers[4].AbsoluteHeight = pf.Layers[2].AbsoluteHeight }, SeverityError, 4, "isn't above"},
+		{"height step", func(pf *PhotonFile) { pf.Layers[5].AbsoluteHeight += 0.02 }, SeverityWarning, 5, "height step"},
+		{"build volume", func(pf *PhotonFile) { pf.PlateZ = 0.2 }, SeverityError, 4, "build volume"},
+		{"image data", func(pf *PhotonFile) { pf.Layers[1].RawData = pf.Layers[1].RawData[1:] }, SeverityError, 1, "covers"},
+		{"anti-aliasing levels", func(pf *PhotonFile) { pf.Layers[0].AntiAliasRawData = nil }, SeverityError, 0, "anti-aliasing levels"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pf := testFile(t, Version2, 4)
+			tt.edit(pf)
+
+			for _, p := range pf.Validate() {
+				if p.Severity == tt.severity && p.Layer == tt.layer && strings.Contains(p.Message, tt.message) {
+					return
+				}
+			}
+			t.Errorf("expected a %v for layer %d about %q, got %v", tt.severity, tt.layer, tt.message, pf.Validate())
+		})
+	}
+}
+
+func TestProblemString(t *testing.T) {
+	p := Problem{Severity: SeverityError, Layer: 3, Message: "bad"}
+	if s := p.String(); s != "error: layer 3: bad" {
+		t.Errorf("got %q", s)
+	}
+	p = Problem{Severity: SeverityWarning, Layer: -1, Message: "odd"}
+	if s := p.String(); s != "warning: odd" {
+		t.Errorf("got %q", s)
+	}
+}